@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/vectorstore"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ingest chunks and embeds a docs directory into the shared MongoDB vector
+// store so every server replica started with VECTOR_STORE=mongodb queries the
+// same corpus.
+func main() {
+	dir := flag.String("dir", "docs", "directory containing .txt, .md and .pdf documents")
+	reset := flag.Bool("reset", false, "drop existing chunks before ingesting")
+	flag.Parse()
+
+	// Failures exit non-zero so a job runner sees the ingestion failed.
+	if err := run(context.Background(), *dir, *reset); err != nil {
+		log.Fatalf("ingest: %v", err)
+	}
+}
+
+func run(ctx context.Context, dir string, reset bool) error {
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(getMongoURI()))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := mongoClient.Disconnect(ctx); err != nil {
+			log.Printf("mongodb disconnect: %v", err)
+		}
+	}()
+
+	database := mongoClient.Database(getMongoDB())
+
+	if reset {
+		if err := database.Collection(getVectorCollection()).Drop(ctx); err != nil {
+			return fmt.Errorf("drop %q: %w", getVectorCollection(), err)
+		}
+	}
+
+	store := vectorstore.NewMongoVectorStore(database, getVectorCollection(), getVectorIndex())
+	embedder := agent.NewEmbedderWithStore(store)
+	if err := embedder.Index(ctx, dir); err != nil {
+		return err
+	}
+
+	n, err := embedder.Len(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("ingest: collection %q now holds %d chunks", getVectorCollection(), n)
+	return nil
+}
+
+func getMongoURI() string {
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+
+	return uri
+}
+
+func getMongoDB() string {
+	db := os.Getenv("MONGODB_DB")
+	if db == "" {
+		db = "agent_sessions"
+	}
+
+	return db
+}
+
+func getVectorCollection() string {
+	collection := os.Getenv("VECTOR_COLLECTION")
+	if collection == "" {
+		collection = "chunks"
+	}
+
+	return collection
+}
+
+func getVectorIndex() string {
+	index := os.Getenv("VECTOR_INDEX")
+	if index == "" {
+		index = "vector_index"
+	}
+
+	return index
+}
@@ -1,34 +1,85 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/rand"
 	_ "embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/m2tx/agent_example/assets"
+	"github.com/m2tx/agent_example/events"
 	"github.com/m2tx/agent_example/internal/agent"
-	"github.com/m2tx/agent_example/internal/functions"
+	"github.com/m2tx/agent_example/internal/auth"
+	"github.com/m2tx/agent_example/internal/health"
 	"github.com/m2tx/agent_example/internal/mcp"
+	"github.com/m2tx/agent_example/internal/mcpserver"
+	"github.com/m2tx/agent_example/internal/model"
 	anthropicprovider "github.com/m2tx/agent_example/internal/provider/anthropic"
 	geminiprovider "github.com/m2tx/agent_example/internal/provider/gemini"
-	"github.com/m2tx/agent_example/internal/repository"
+	"github.com/m2tx/agent_example/internal/quota"
+	"github.com/m2tx/agent_example/internal/tenant"
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"google.golang.org/genai"
 )
 
+const (
+	// shutdownGrace is how long cancelled requests get to save their state
+	// and return.
+	shutdownGrace = 5 * time.Second
+
+	// heartbeatInterval is how long an event stream may stay idle before a
+	// heartbeat is sent.
+	heartbeatInterval = 15 * time.Second
+
+	// disconnectTimeout bounds the MongoDB disconnect on exit.
+	disconnectTimeout = 10 * time.Second
+)
+
 func main() {
-	ctx := context.Background()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// errShuttingDown cancels the requests still running when the shutdown
+// timeout expires.
+var errShuttingDown = errors.New("server is shutting down")
+
+// run starts the server and blocks until it fails or receives SIGINT or
+// SIGTERM. Resources are released in reverse order of creation: the HTTP
+// server first, then MCP sessions, then MongoDB.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(getMongoURI()))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+		defer cancel()
 		if err := mongoClient.Disconnect(ctx); err != nil {
 			log.Printf("mongodb disconnect: %v", err)
 		}
@@ -36,65 +87,179 @@ func main() {
 
 	database := mongoClient.Database(getMongoDB())
 
-	repo := repository.NewMongoSessionRepository(database, "sessions")
-
-	embedder := agent.NewEmbedder()
-	if err := embedder.Index("../../docs"); err != nil {
-		log.Fatal(err)
-	}
-
-	provider, err := buildProvider(ctx)
+	authn, err := getAuthenticator(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	a := agent.NewWithRepo(provider, assets.SystemInstruction, repo)
-
-	mcpClient, err := mcp.NewClient(ctx, getMcpServerURL(), getMcpTransport())
-	if err != nil {
-		log.Fatal(err)
+	operators := getMcpOperators()
+	if authn == nil && slices.Contains(operators, "*") {
+		log.Printf("warning: MCP_OAUTH_OPERATORS=* and AUTH_MODE is unset: anyone can authorize MCP servers")
 	}
 
-	err = mcpClient.RegisterTools(ctx, a)
+	tenantConfig, mcpConfigs, err := getTenantConfig()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = mcpClient.RegisterPrompts(ctx, a)
+	spend, err := getQuotaStore(database)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	err = a.AddFunctionCall(functions.CreateWeatherFunctionDeclaration())
+	prices, err := getPrices()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = a.AddFunctionCall(functions.CreateCompanyFunctionDeclaration())
+	ts, err := newTenants(ctx, tenantConfig, mcpConfigs, database, spend, prices)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer ts.close()
 
-	err = a.AddFunctionCall(functions.CreateCollaboratorsFunctionDeclaration())
+	// Prompts are rate limited per user and per client address, so that a
+	// single caller cannot exhaust a tenant's budget on their own.
+	proxies, err := getTrustedProxies()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	burst := getRateLimitBurst()
+	userLimiter := quota.NewLimiter("user", getRateLimit("RATE_LIMIT_USER", 30), burst)
+	ipLimiter := quota.NewLimiter("address", getRateLimit("RATE_LIMIT_IP", 60), burst)
+	rateLimit := func(r *http.Request) error {
+		if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+			if err := userLimiter.Allow(p.Subject); err != nil {
+				return err
+			}
+		}
+		return ipLimiter.Allow(proxies.ClientAddr(r))
 	}
 
-	err = a.AddFunctionCall(functions.CreateDocsSearchFunctionDeclaration(embedder))
-	if err != nil {
-		log.Fatal(err)
+	// The agent can itself be served over MCP, to other agents and IDEs.
+	if mode := getMcpServe(); mode != "" {
+		for _, t := range ts.list() {
+			t.serveMCP()
+		}
+
+		switch mode {
+		case "stdio":
+			// stdout carries the protocol, so the HTTP server is not started
+			// and only the default tenant is served. There is no readiness
+			// probe either, so wait for the index.
+			t, ok := ts.defaultAgent()
+			if !ok {
+				return fmt.Errorf("MCP_SERVE=stdio requires a default tenant")
+			}
+			<-t.indexed
+			if t.indexErr != nil {
+				return t.indexErr
+			}
+			if err := t.mcpServer.SyncDocuments(ctx); err != nil {
+				return err
+			}
+			if err := t.mcpServer.RunStdio(ctx); err != nil {
+				log.Printf("mcp server: %v", err)
+			}
+			return nil
+		case "http":
+			for _, t := range ts.list() {
+				go func() {
+					<-t.indexed
+					t.syncDocuments(ctx)
+				}()
+			}
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if t, ok := ts.forRequest(w, r); ok {
+					t.mcpHandler.ServeHTTP(w, r)
+				}
+			})
+			if authn != nil {
+				// The MCP transport binds its sessions to the user of the
+				// token, so clients must authenticate with a bearer token.
+				handler = mcpauth.RequireBearerToken(mcpTokenVerifier, nil)(handler)
+			}
+			http.Handle("/mcp", handler)
+		default:
+			return fmt.Errorf("unknown MCP_SERVE mode %q", mode)
+		}
 	}
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFileFS(w, r, assets.Dir, "chat.html")
 	})
 
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		status := map[string]any{"status": "ok"}
+		if t, ok := ts.defaultAgent(); ok {
+			status["mcp"] = t.mcp.Status()
+		}
+		if len(ts.agents) > 1 {
+			byTenant := make(map[string]any, len(ts.agents))
+			for _, t := range ts.list() {
+				byTenant[t.name] = map[string]any{"mcp": t.mcp.Status()}
+			}
+			status["tenants"] = byTenant
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+
+	checker := health.NewChecker(getReadinessTimeout())
+	checker.Add("mongodb", true, func(ctx context.Context) error {
+		return mongoClient.Ping(ctx, nil)
+	})
+	for _, t := range ts.list() {
+		// Checks are named after the tenant once there are several.
+		prefix := ""
+		if len(ts.agents) > 1 {
+			prefix = t.name + "/"
+		}
+		checker.Add(prefix+"documents", true, t.documentsReady)
+		checker.Add(prefix+"provider", true, func(ctx context.Context) error {
+			if t.provider == nil {
+				return errors.New("no LLM provider configured")
+			}
+			return nil
+		})
+		for _, c := range t.mcp.Clients() {
+			checker.Add(prefix+"mcp:"+c.Name(), c.Status().Required, c.Ping)
+		}
+	}
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := checker.Run(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+
 	http.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
 		sessionID := r.URL.Query().Get("session_id")
 		if sessionID == "" {
 			http.Error(w, "session_id is required", http.StatusBadRequest)
@@ -105,9 +270,8 @@ func main() {
 		w.Header().Set("Cache-Control", "no-cache")
 
 		if r.Method == http.MethodGet {
-			contents, err := a.GetSession(r.Context(), sessionID)
-			if err != nil {
-				http.Error(w, "get session", http.StatusInternalServerError)
+			contents, err := t.agent.GetSession(r.Context(), sessionID)
+			if !sessionAllowed(w, err) {
 				return
 			}
 
@@ -115,8 +279,292 @@ func main() {
 		}
 
 		if r.Method == http.MethodDelete {
-			a.ClearSession(r.Context(), sessionID)
+			if !sessionAllowed(w, t.agent.ClearSession(r.Context(), sessionID)) {
+				return
+			}
+		}
+	})
+
+	http.HandleFunc("/documents", func(w http.ResponseWriter, r *http.Request) {
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			infos, err := t.embedder.Documents(r.Context())
+			if err != nil {
+				http.Error(w, "list documents", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(infos)
+
+		case http.MethodPost:
+			maxBytes := getDocsMaxUploadBytes()
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+			if err := r.ParseMultipartForm(maxBytes); err != nil {
+				http.Error(w, "invalid multipart form: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "file is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			if header.Size > maxBytes {
+				http.Error(w, fmt.Sprintf("file exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			data, err := io.ReadAll(file)
+			if err != nil {
+				http.Error(w, "read file", http.StatusBadRequest)
+				return
+			}
+
+			if err := validateDocument(header.Filename, data); err != nil {
+				http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+				return
+			}
+
+			info, err := t.embedder.AddDocument(r.Context(), filepath.Base(header.Filename), data, map[string]any{
+				"source":       "upload",
+				"content_type": http.DetectContentType(data),
+			})
+			if errors.Is(err, agent.ErrEmptyDocument) {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			if err != nil {
+				http.Error(w, "add document", http.StatusInternalServerError)
+				return
+			}
+
+			t.syncDocuments(r.Context())
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(info)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		documentID := r.PathValue("id")
+
+		chunks, err := t.embedder.Document(r.Context(), documentID)
+		if err != nil {
+			http.Error(w, "get document", http.StatusInternalServerError)
+			return
+		}
+		if len(chunks) == 0 {
+			http.Error(w, "document not found", http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"id":       documentID,
+				"filename": chunks[0].Filename,
+				"metadata": chunks[0].Metadata,
+				"chunks":   chunks,
+			})
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := t.embedder.DeleteDocument(r.Context(), documentID); err != nil {
+				http.Error(w, "delete document", http.StatusInternalServerError)
+				return
+			}
+			t.syncDocuments(r.Context())
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	// MCP servers using the authorization_code flow are authorized once by an
+	// operator listed in MCP_OAUTH_OPERATORS: /mcp/oauth/{server} redirects to
+	// the authorization server, which sends the browser back to the callback
+	// with the code.
+	http.HandleFunc("/mcp/oauth/callback", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		if e := query.Get("error"); e != "" {
+			http.Error(w, "authorization failed: "+e+" "+query.Get("error_description"), http.StatusBadRequest)
+			return
+		}
+
+		// The callback carries no credentials, so the tenant that started
+		// the authorization is found by its state.
+		var (
+			server string
+			err    error
+		)
+		for _, t := range ts.list() {
+			server, err = t.mcp.CompleteAuthorization(r.Context(), query.Get("state"), query.Get("code"))
+			if !errors.Is(err, mcp.ErrUnknownAuthorization) {
+				break
+			}
+		}
+		if errors.Is(err, mcp.ErrUnknownAuthorization) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		fmt.Fprintf(w, "MCP server %q authorized; it will reconnect shortly.\n", server)
+	})
+
+	http.HandleFunc("/mcp/oauth/{server}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The tokens obtained replace the server's credentials for every
+		// user of the tenant.
+		if p, _ := auth.PrincipalFromContext(r.Context()); !operators.allows(p) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		authURL, err := t.mcp.AuthorizationURL(r.Context(), r.PathValue("server"))
+		if errors.Is(err, mcp.ErrUnknownServer) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+
+	http.HandleFunc("/commands", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.mcp.Commands())
+	})
+
+	http.HandleFunc("/prompt/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			SessionID string `json:"session_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.SessionID == "" {
+			http.Error(w, "session_id is required", http.StatusBadRequest)
+			return
+		}
+
+		if !sessionAllowed(w, t.agent.AuthorizeSession(r.Context(), req.SessionID)) {
+			return
+		}
+
+		if !t.agent.Cancel(req.SessionID) {
+			http.Error(w, "no prompt running for session", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	elicitations := mcp.NewElicitations()
+
+	http.HandleFunc("/elicitations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			SessionID string         `json:"session_id"`
+			Action    string         `json:"action"`
+			Content   map[string]any `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.SessionID == "" {
+			http.Error(w, "session_id is required", http.StatusBadRequest)
+			return
+		}
+
+		if !sessionAllowed(w, t.agent.AuthorizeSession(r.Context(), req.SessionID)) {
+			return
+		}
+
+		err := elicitations.Answer(req.SessionID, r.PathValue("id"), req.Action, req.Content)
+		if errors.Is(err, mcp.ErrElicitationNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+
+		w.WriteHeader(http.StatusNoContent)
 	})
 
 	http.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
@@ -125,6 +573,15 @@ func main() {
 			return
 		}
 
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if !withinLimits(w, rateLimit(r)) {
+			return
+		}
+
 		var req struct {
 			SessionID string `json:"session_id"`
 			Prompt    string `json:"prompt"`
@@ -144,6 +601,38 @@ func main() {
 			return
 		}
 
+		if !sessionAllowed(w, t.agent.ClaimSession(r.Context(), req.SessionID)) {
+			return
+		}
+
+		// Once the stream has started, a budget used up during the turn is
+		// reported as an error event instead.
+		if !withinLimits(w, t.meter.Check(r.Context())) {
+			return
+		}
+
+		// A prompt starting with a known slash command is replaced by the MCP
+		// prompt it names; anything else is sent as typed.
+		prompt := req.Prompt
+		var (
+			command      bool
+			commandTurns []model.Content
+		)
+		if strings.HasPrefix(prompt, "/") {
+			turns, expanded, err := t.mcp.ExpandCommand(r.Context(), prompt)
+			switch {
+			case errors.Is(err, mcp.ErrUnknownCommand):
+			case errors.Is(err, mcp.ErrInvalidCommand):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			default:
+				command, commandTurns, prompt = true, turns, expanded
+			}
+		}
+
 		flusher, ok := w.(http.Flusher)
 		if !ok {
 			http.Error(w, "streaming not supported", http.StatusInternalServerError)
@@ -154,42 +643,288 @@ func main() {
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
-		writeEvent := func(eventType, content string) {
-			data, _ := json.Marshal(map[string]string{"type": eventType, "content": content})
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
+		messageID := newMessageID()
+		stream := events.NewWriter(w, flusher.Flush, messageID)
+		stopHeartbeat := stream.KeepAlive(heartbeatInterval)
+		defer stopHeartbeat()
+
+		started := time.Now()
+		var (
+			usageMu sync.Mutex
+			usage   events.Usage
+		)
+		end := func(reason events.StopReason) {
+			usageMu.Lock()
+			total := usage
+			usageMu.Unlock()
+			stream.Send(events.MessageEnd{
+				MessageID:  messageID,
+				StopReason: reason,
+				Usage:      total,
+				DurationMS: milliseconds(time.Since(started)),
+			})
+		}
+		fail := func(err error) {
+			e := events.Error{Code: events.CodeInternal, Message: err.Error()}
+			var limit *quota.LimitError
+			switch {
+			case errors.As(err, &limit):
+				e.Code, e.RetryAfter = events.CodeRateLimited, math.Ceil(limit.RetryAfter.Seconds())
+			case errors.Is(err, agent.ErrSessionForbidden):
+				e.Code = events.CodeForbidden
+			}
+			stream.Send(e)
+			end(events.StopError)
 		}
 
-		err := a.SendStream(r.Context(), req.SessionID, req.Prompt, func(text string) error {
-			writeEvent("text", text)
-			return nil
-		}, func(name string, args map[string]any) error {
-			writeEvent("function_call", name)
-			return nil
-		}, func() error {
-			writeEvent("turn_done", "")
-			return nil
+		stream.Send(events.MessageStart{
+			Version:   events.Version,
+			MessageID: messageID,
+			SessionID: req.SessionID,
+			Tenant:    t.name,
+			Model:     t.model,
+		})
+
+		ctx := userContext(r)
+		ctx = agent.WithUsageRecorder(ctx, func(_ context.Context, u agent.Usage) {
+			usageMu.Lock()
+			usage.InputTokens += u.InputTokens
+			usage.OutputTokens += u.OutputTokens
+			usageMu.Unlock()
+			stream.Send(events.Usage{Model: u.Model, InputTokens: u.InputTokens, OutputTokens: u.OutputTokens})
+		})
+		ctx = agent.WithToolObserver(ctx, agent.ToolObserver{
+			OnCall: func(c agent.ToolCall) {
+				stream.Send(events.ToolCall{ID: c.ID, Name: c.Name, Args: c.Args})
+			},
+			OnResult: func(res agent.ToolResult) {
+				e := events.ToolResult{ID: res.ID, Name: res.Name, Result: res.Response, DurationMS: milliseconds(res.Duration)}
+				if res.Err != nil {
+					e.Result, e.Error = nil, res.Err.Error()
+				}
+				stream.Send(e)
+			},
+		})
+		ctx = mcp.WithProgress(ctx, func(p mcp.ToolProgress) {
+			stream.Send(events.ToolProgress(p))
+		})
+		ctx = mcp.WithElicitor(ctx, func(ctx context.Context, server string, params *mcpsdk.ElicitParams) (*mcpsdk.ElicitResult, error) {
+			return elicitations.Ask(ctx, req.SessionID, server, params, func(e mcp.Elicitation) error {
+				return stream.Send(events.Elicitation(e))
+			})
 		})
+
+		if command {
+			ctx = agent.WithPrecedingTurns(ctx, commandTurns...)
+			stream.Send(events.Command{Turns: commandTurns, Prompt: prompt})
+		}
+
+		err := t.agent.SendStream(ctx, req.SessionID, prompt, func(text string) error {
+			return stream.Send(events.Text{Text: text})
+		}, nil, func() error {
+			return stream.Send(events.TurnDone{})
+		}, func(citations []model.Citation) error {
+			return stream.Send(events.Citations{Citations: citations})
+		})
+		if errors.Is(context.Cause(r.Context()), errShuttingDown) {
+			stream.Send(events.Error{Code: events.CodeShuttingDown, Message: "server is shutting down; the partial answer was saved"})
+			end(events.StopShutdown)
+			return
+		}
+		if errors.Is(err, context.Canceled) && r.Context().Err() == nil {
+			end(events.StopCancelled)
+			return
+		}
 		if err != nil {
-			writeEvent("error", err.Error())
+			fail(err)
 			return
 		}
 
-		writeEvent("done", "")
+		end(events.StopEndTurn)
 	})
 
-	log.Fatal(http.ListenAndServe(":"+getHttpPort(), nil))
+	// OpenAI-compatible API, for clients and SDKs written for OpenAI.
+	http.HandleFunc("/v1/chat/completions", chatCompletions(ts, rateLimit))
+	http.HandleFunc("/v1/models", listModels(ts))
+
+	// Requests derive from requestCtx so that turns still running when the
+	// shutdown timeout expires can be cancelled.
+	requestCtx, cancelRequests := context.WithCancelCause(context.Background())
+	defer cancelRequests(nil)
+
+	server := &http.Server{
+		Addr:        ":" + getHttpPort(),
+		Handler:     http.DefaultServeMux,
+		BaseContext: func(net.Listener) context.Context { return requestCtx },
+	}
+	if authn != nil {
+		// The chat page, probes and the OAuth redirect from MCP authorization
+		// servers are reached without credentials.
+		server.Handler = auth.Middleware(authn, http.DefaultServeMux, "/", "/healthz", "/readyz", "/mcp/oauth/callback")
+	}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+	log.Printf("listening on %s", server.Addr)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal terminates the process immediately.
+	stop()
+
+	return shutdown(server, cancelRequests)
+}
+
+// shutdown stops accepting connections and waits for in-flight requests,
+// such as streaming turns, to finish. Requests still running after
+// SHUTDOWN_TIMEOUT are cancelled, which saves the partial answer of their
+// turn, and given a short grace period to return.
+func shutdown(server *http.Server, cancelRequests context.CancelCauseFunc) error {
+	timeout := getShutdownTimeout()
+	log.Printf("shutting down, waiting up to %s for in-flight requests", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err == nil {
+		return nil
+	}
+
+	log.Printf("shutdown timeout expired, cancelling in-flight requests")
+	cancelRequests(errShuttingDown)
+
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+		return server.Close()
+	}
+	return nil
+}
+
+// validateDocument checks that an uploaded file has a supported extension and
+// that its content matches that extension.
+func validateDocument(filename string, data []byte) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !slices.Contains(agent.SupportedDocumentExtensions, ext) {
+		return fmt.Errorf("unsupported file type %q: allowed %s", ext, strings.Join(agent.SupportedDocumentExtensions, ", "))
+	}
+
+	contentType := http.DetectContentType(data)
+	switch ext {
+	case ".pdf":
+		if contentType != "application/pdf" {
+			return fmt.Errorf("file content is %s, not a PDF", contentType)
+		}
+	default:
+		if !strings.HasPrefix(contentType, "text/plain") {
+			return fmt.Errorf("file content is %s, not plain text", contentType)
+		}
+	}
+
+	return nil
+}
+
+// sessionAllowed reports whether a session ownership check passed. When it
+// failed it writes the error: 403 for a session of another user, 500
+// otherwise.
+func sessionAllowed(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, agent.ErrSessionForbidden) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	if err != nil {
+		log.Printf("session: %v", err)
+		http.Error(w, "session lookup failed", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// mcpOperators lists the subjects allowed to authorize MCP servers. "*"
+// allows every caller, including anonymous ones when auth is disabled.
+type mcpOperators []string
+
+func (o mcpOperators) allows(p *auth.Principal) bool {
+	if slices.Contains(o, "*") {
+		return true
+	}
+	return p != nil && slices.Contains(o, p.Subject)
+}
+
+// newMessageID identifies the stream of one turn.
+func newMessageID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "msg_" + hex.EncodeToString(b)
 }
 
-func buildProvider(ctx context.Context) (agent.LLMProvider, error) {
-	switch getProviderName() {
+// milliseconds returns d in fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// userContext returns the context of r carrying the caller's token: MCP
+// servers configured with forwardUserToken receive the bearer token with
+// every tool call. API keys are never forwarded.
+func userContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		if p.Token != "" {
+			ctx = agent.WithUserToken(ctx, p.Token)
+		}
+	} else if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		ctx = agent.WithUserToken(ctx, token)
+	}
+	return ctx
+}
+
+// withinLimits writes 429 with Retry-After when err is a quota limit, or
+// 500 for any other error, and reports whether the request may proceed.
+func withinLimits(w http.ResponseWriter, err error) bool {
+	var limit *quota.LimitError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &limit):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.RetryAfter.Seconds()))))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
+
+// mcpTokenVerifier hands the principal authenticated by auth.Middleware to
+// the MCP transport, which keeps each MCP session to its user and passes the
+// principal on to tool calls.
+func mcpTokenVerifier(ctx context.Context, _ string, _ *http.Request) (*mcpauth.TokenInfo, error) {
+	p, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, mcpauth.ErrInvalidToken
+	}
+	expiry := p.Expiry
+	if expiry.IsZero() {
+		expiry = time.Now().Add(time.Hour)
+	}
+	return &mcpauth.TokenInfo{
+		UserID:     p.Subject,
+		Expiration: expiry,
+		Extra:      map[string]any{mcpserver.PrincipalKey: p},
+	}, nil
+}
+
+func buildProvider(ctx context.Context, name string, model string) (agent.LLMProvider, error) {
+	switch name {
 	case "anthropic":
 		apiKey := os.Getenv("ANTHROPIC_API_KEY")
 		if apiKey == "" {
-			return nil, fmt.Errorf("ANTHROPIC_API_KEY is required when PROVIDER=anthropic")
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY is required for the anthropic provider")
 		}
-		return anthropicprovider.New(apiKey, getModel()), nil
-	default:
+		return anthropicprovider.New(apiKey, model), nil
+	case "gemini":
 		client, err := genai.NewClient(ctx, &genai.ClientConfig{
 			Backend:     genai.BackendGeminiAPI,
 			HTTPOptions: genai.HTTPOptions{APIVersion: "v1beta"},
@@ -197,7 +932,9 @@ func buildProvider(ctx context.Context) (agent.LLMProvider, error) {
 		if err != nil {
 			return nil, fmt.Errorf("gemini client: %w", err)
 		}
-		return geminiprovider.New(client, getModel()), nil
+		return geminiprovider.New(client, model), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q", name)
 	}
 }
 
@@ -209,17 +946,209 @@ func getProviderName() string {
 	return p
 }
 
-func getModel() string {
-	model := os.Getenv("MODEL")
-	if model != "" {
+// defaultModel returns the model used with provider when none is configured:
+// MODEL for the PROVIDER of the environment, else the provider's default.
+func defaultModel(provider string) string {
+	if model := os.Getenv("MODEL"); model != "" && provider == getProviderName() {
 		return model
 	}
-	if getProviderName() == "anthropic" {
+	if provider == "anthropic" {
 		return "claude-opus-4-7"
 	}
 	return "gemini-2.5-flash"
 }
 
+// getTenantConfig loads the tenants from TENANTS_CONFIG, with the MCP
+// configuration of each. Without it, a single "default" tenant is configured
+// from the environment and keeps the original session collection.
+func getTenantConfig() (*tenant.Config, map[string]*mcp.Config, error) {
+	path := os.Getenv("TENANTS_CONFIG")
+	if path == "" {
+		mcpConfig, err := getMcpConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg := &tenant.Config{
+			Default: "default",
+			Header:  tenant.DefaultHeader,
+			Tenants: map[string]tenant.Tenant{"default": {Name: "default", Sampling: getSampling()}},
+		}
+		return cfg, map[string]*mcp.Config{"default": mcpConfig}, nil
+	}
+
+	cfg, err := tenant.LoadConfig(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mcpConfigs := make(map[string]*mcp.Config, len(cfg.Tenants))
+	for name, t := range cfg.Tenants {
+		if t.MCPConfig == "" {
+			mcpConfigs[name] = &mcp.Config{}
+			continue
+		}
+		mcpConfig, err := mcp.LoadConfig(t.MCPConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tenant %q: %w", name, err)
+		}
+		mcpConfigs[name] = mcpConfig
+	}
+	return cfg, mcpConfigs, nil
+}
+
+// getSampling returns the MCP servers allowed to send sampling requests,
+// listed in MCP_SAMPLING_SERVERS, when TENANTS_CONFIG is not set.
+func getSampling() tenant.Sampling {
+	var sampling tenant.Sampling
+	for server := range strings.SplitSeq(os.Getenv("MCP_SAMPLING_SERVERS"), ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			sampling.Servers = append(sampling.Servers, server)
+		}
+	}
+	return sampling
+}
+
+// getRateLimit returns the requests per minute allowed by the env var
+// name; 0 disables the limit.
+func getRateLimit(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+// getRateLimitBurst returns how many prompts a caller may send at once
+// before the rate limits apply.
+func getRateLimitBurst() int {
+	n, err := strconv.Atoi(os.Getenv("RATE_LIMIT_BURST"))
+	if err != nil || n <= 0 {
+		return 10
+	}
+	return n
+}
+
+// getDailyBudget returns the daily budget of tenants that set none.
+func getDailyBudget() quota.Budget {
+	var b quota.Budget
+	if n, err := strconv.ParseInt(os.Getenv("DAILY_TOKEN_BUDGET"), 10, 64); err == nil && n > 0 {
+		b.DailyTokens = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("DAILY_COST_BUDGET"), 64); err == nil && f > 0 {
+		b.DailyCost = f
+	}
+	return b
+}
+
+// getPrices loads the model prices used for cost budgets from PRICES_FILE.
+func getPrices() (quota.Prices, error) {
+	path := os.Getenv("PRICES_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	return quota.LoadPrices(path)
+}
+
+// getQuotaStore returns where the daily spend of tenants is kept.
+func getQuotaStore(database *mongo.Database) (quota.Store, error) {
+	switch store := os.Getenv("QUOTA_STORE"); store {
+	case "", "mongodb":
+		return quota.NewMongoStore(database, os.Getenv("QUOTA_COLLECTION")), nil
+	case "memory":
+		return quota.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown QUOTA_STORE %q", store)
+	}
+}
+
+// getReadinessTimeout returns how long each readiness check may take.
+func getReadinessTimeout() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("READINESS_TIMEOUT"))
+	if err != nil || d <= 0 {
+		return 2 * time.Second
+	}
+
+	return d
+}
+
+// getTrustedProxies parses AUTH_TRUSTED_PROXIES, the reverse proxies whose
+// X-Forwarded-For and trusted header are believed.
+func getTrustedProxies() (auth.Proxies, error) {
+	return auth.ParseProxies(strings.Split(os.Getenv("AUTH_TRUSTED_PROXIES"), ","))
+}
+
+// getAuthenticator builds the authenticators listed in AUTH_MODE, tried in
+// order. It returns nil when AUTH_MODE is empty and the API is open.
+func getAuthenticator(ctx context.Context) (auth.Authenticator, error) {
+	var chain auth.Chain
+	for mode := range strings.SplitSeq(os.Getenv("AUTH_MODE"), ",") {
+		switch strings.TrimSpace(mode) {
+		case "":
+		case "apikey":
+			keys, err := auth.ParseAPIKeys(os.Getenv("AUTH_API_KEYS"))
+			if err != nil {
+				return nil, err
+			}
+			if path := os.Getenv("AUTH_API_KEYS_FILE"); path != "" {
+				fileKeys, err := auth.LoadAPIKeys(path)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, fileKeys...)
+			}
+			if len(keys) == 0 {
+				return nil, fmt.Errorf("AUTH_MODE=apikey requires AUTH_API_KEYS or AUTH_API_KEYS_FILE")
+			}
+			a, err := auth.NewAPIKeys(keys...)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		case "jwt":
+			a, err := auth.NewJWT(ctx, auth.JWTConfig{
+				JWKS:         os.Getenv("AUTH_JWKS"),
+				Issuer:       os.Getenv("AUTH_JWT_ISSUER"),
+				Audience:     os.Getenv("AUTH_JWT_AUDIENCE"),
+				SubjectClaim: os.Getenv("AUTH_JWT_SUBJECT_CLAIM"),
+				TenantClaim:  os.Getenv("AUTH_JWT_TENANT_CLAIM"),
+			})
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		case "header":
+			if os.Getenv("AUTH_TRUSTED_PROXIES") == "" {
+				return nil, fmt.Errorf("AUTH_MODE=header requires AUTH_TRUSTED_PROXIES")
+			}
+			header := cmp.Or(os.Getenv("AUTH_TRUSTED_HEADER"), "X-Forwarded-User")
+			proxies := strings.Split(os.Getenv("AUTH_TRUSTED_PROXIES"), ",")
+			a, err := auth.NewTrustedHeader(header, os.Getenv("AUTH_TRUSTED_NAME_HEADER"), proxies)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		default:
+			return nil, fmt.Errorf("unknown AUTH_MODE %q", mode)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// getShutdownTimeout returns how long a shutdown waits for in-flight requests
+// before cancelling them.
+func getShutdownTimeout() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || d <= 0 {
+		return 30 * time.Second
+	}
+
+	return d
+}
+
 func getHttpPort() string {
 	port := os.Getenv("HTTP_PORT")
 	if port == "" {
@@ -247,6 +1176,87 @@ func getMongoDB() string {
 	return db
 }
 
+func getDocsDir() string {
+	dir := os.Getenv("DOCS_DIR")
+	if dir == "" {
+		dir = "../../docs"
+	}
+
+	return dir
+}
+
+func getDocsMaxUploadBytes() int64 {
+	n, err := strconv.ParseInt(os.Getenv("DOCS_MAX_UPLOAD_BYTES"), 10, 64)
+	if err != nil || n <= 0 {
+		return 10 << 20
+	}
+
+	return n
+}
+
+func getVectorStore() string {
+	store := os.Getenv("VECTOR_STORE")
+	if store == "" {
+		return "memory"
+	}
+
+	return store
+}
+
+func getVectorCollection() string {
+	collection := os.Getenv("VECTOR_COLLECTION")
+	if collection == "" {
+		collection = "chunks"
+	}
+
+	return collection
+}
+
+func getVectorIndex() string {
+	index := os.Getenv("VECTOR_INDEX")
+	if index == "" {
+		index = "vector_index"
+	}
+
+	return index
+}
+
+// getMcpServe returns how the agent is served over MCP: "http" adds a
+// streamable endpoint at /mcp, "stdio" serves a single client over
+// stdin/stdout instead of HTTP, and empty disables it.
+func getMcpServe() string {
+	return os.Getenv("MCP_SERVE")
+}
+
+// getMcpOperators returns the subjects listed in MCP_OAUTH_OPERATORS. Without
+// any, MCP servers using the authorization_code flow cannot be authorized.
+func getMcpOperators() mcpOperators {
+	var operators mcpOperators
+	for subject := range strings.SplitSeq(os.Getenv("MCP_OAUTH_OPERATORS"), ",") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			operators = append(operators, subject)
+		}
+	}
+	return operators
+}
+
+// getMcpConfig loads the MCP server list from MCP_CONFIG. Without it, a single
+// required server is built from MCP_SERVER_URL and MCP_TRANSPORT.
+func getMcpConfig() (*mcp.Config, error) {
+	if path := os.Getenv("MCP_CONFIG"); path != "" {
+		return mcp.LoadConfig(path)
+	}
+
+	return &mcp.Config{Servers: map[string]mcp.ServerConfig{
+		"default": {
+			Name:      "default",
+			URL:       getMcpServerURL(),
+			Transport: getMcpTransport(),
+			Required:  true,
+		},
+	}}, nil
+}
+
 func getMcpServerURL() string {
 	uri := os.Getenv("MCP_SERVER_URL")
 	if uri == "" {
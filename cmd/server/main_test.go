@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/auth"
+)
+
+func TestMcpOperatorsAllows(t *testing.T) {
+	alice, bob := &auth.Principal{Subject: "alice"}, &auth.Principal{Subject: "bob"}
+
+	tests := []struct {
+		name      string
+		operators mcpOperators
+		principal *auth.Principal
+		want      bool
+	}{
+		{name: "operator", operators: mcpOperators{"alice"}, principal: alice, want: true},
+		{name: "other user", operators: mcpOperators{"alice"}, principal: bob},
+		{name: "none configured", principal: alice},
+		{name: "auth disabled", operators: mcpOperators{"alice"}},
+		{name: "everyone", operators: mcpOperators{"*"}, principal: bob, want: true},
+		{name: "everyone, auth disabled", operators: mcpOperators{"*"}, want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.operators.allows(tt.principal); got != tt.want {
+			t.Errorf("%s: allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetMcpOperators(t *testing.T) {
+	t.Setenv("MCP_OAUTH_OPERATORS", " alice, ,bob ")
+	if got := getMcpOperators(); len(got) != 2 || got[0] != "alice" || got[1] != "bob" {
+		t.Errorf("getMcpOperators = %q", got)
+	}
+	t.Setenv("MCP_OAUTH_OPERATORS", "")
+	if got := getMcpOperators(); len(got) != 0 {
+		t.Errorf("getMcpOperators = %q, want none", got)
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/m2tx/agent_example/internal/quota"
+)
+
+// sessionHeader makes /v1/chat/completions continue a stored session
+// instead of using the conversation in the request.
+const sessionHeader = "X-Session-ID"
+
+// chatCompletionRequest is the subset of the OpenAI Chat Completions
+// request the agent understands. Sampling parameters are ignored.
+type chatCompletionRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages"`
+	Stream        bool          `json:"stream"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+
+	// Tools are the client's own functions, which the agent cannot call; it
+	// only uses its server-side tools.
+	Tools []json.RawMessage `json:"tools"`
+}
+
+type chatMessage struct {
+	Role    string         `json:"role"`
+	Content messageContent `json:"content"`
+}
+
+// messageContent is the text of a message, sent either as a string or as an
+// array of content parts.
+type messageContent string
+
+func (c *messageContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*c = ""
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = messageContent(text)
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of parts")
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type != "text" {
+			return fmt.Errorf("content part type %q is not supported", p.Type)
+		}
+		b.WriteString(p.Text)
+	}
+	*c = messageContent(b.String())
+	return nil
+}
+
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+type chatChoice struct {
+	Index        int              `json:"index"`
+	Message      *assistantOutput `json:"message,omitempty"`
+	Delta        *assistantDelta  `json:"delta,omitempty"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+type assistantOutput struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type assistantDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type chatUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// usageCounter sums the usage of the model calls of a turn.
+type usageCounter struct {
+	mu    sync.Mutex
+	usage chatUsage
+}
+
+func (c *usageCounter) record(_ context.Context, u agent.Usage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage.PromptTokens += u.InputTokens
+	c.usage.CompletionTokens += u.OutputTokens
+	c.usage.TotalTokens += u.Total()
+}
+
+func (c *usageCounter) total() *chatUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u := c.usage
+	return &u
+}
+
+// conversation splits messages into the system instruction they add, the
+// history and the prompt, which must be the last message and from the user.
+func conversation(messages []chatMessage) (system string, history []model.Content, prompt string, err error) {
+	if len(messages) == 0 {
+		return "", nil, "", errors.New("messages must not be empty")
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "user" || last.Content == "" {
+		return "", nil, "", errors.New("the last message must be a non-empty user message")
+	}
+
+	var instructions []string
+	for _, m := range messages[:len(messages)-1] {
+		switch m.Role {
+		case "system", "developer":
+			instructions = append(instructions, string(m.Content))
+		case "user":
+			history = append(history, model.Content{Role: "user", Parts: []model.Part{{Text: string(m.Content)}}})
+		case "assistant":
+			history = append(history, model.Content{Role: "model", Parts: []model.Part{{Text: string(m.Content)}}})
+		default:
+			return "", nil, "", fmt.Errorf("messages with role %q are not supported", m.Role)
+		}
+	}
+	return strings.Join(instructions, "\n\n"), history, string(last.Content), nil
+}
+
+// stepSeparator separates the text the model writes before calling tools
+// from the text it writes after, in both streamed and whole completions.
+const stepSeparator = "\n\n"
+
+// modelText returns all the text the model wrote in a turn, as streamed:
+// text written before calling tools comes first, separated from what follows
+// by stepSeparator.
+func modelText(contents []model.Content) string {
+	var steps []string
+	for _, c := range contents {
+		if c.Role != "model" {
+			continue
+		}
+		var b strings.Builder
+		for _, p := range c.Parts {
+			b.WriteString(p.Text)
+		}
+		if b.Len() > 0 {
+			steps = append(steps, b.String())
+		}
+	}
+	return strings.Join(steps, stepSeparator)
+}
+
+func newCompletionID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+// writeOpenAIError writes an error in the OpenAI format, which OpenAI SDKs
+// surface to their callers.
+func writeOpenAIError(w http.ResponseWriter, status int, errType string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": errType},
+	})
+}
+
+// openAIFailure writes err with the status matching its cause.
+func openAIFailure(w http.ResponseWriter, err error) {
+	var limit *quota.LimitError
+	switch {
+	case errors.As(err, &limit):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.RetryAfter.Seconds()))))
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_error", err.Error())
+	case errors.Is(err, agent.ErrSessionForbidden):
+		writeOpenAIError(w, http.StatusForbidden, "permission_error", err.Error())
+	default:
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", err.Error())
+	}
+}
+
+// chatCompletions serves an OpenAI-compatible Chat Completions endpoint
+// backed by the tenant's agent, so OpenAI clients get its tools, MCP servers
+// and documents. With an X-Session-ID header the turn continues that stored
+// session: the request holds only the new user message and, optionally,
+// system messages applied to this turn. Otherwise the request's messages are
+// the whole conversation and nothing is stored. Streamed or not, the
+// completion holds all the text the model wrote, including what it wrote
+// before calling tools, since a stream cannot take back text already sent.
+func chatCompletions(ts *tenants, rateLimit func(*http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+			return
+		}
+
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := rateLimit(r); err != nil {
+			openAIFailure(w, err)
+			return
+		}
+
+		var req chatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		if len(req.Tools) > 0 {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "client-side tools are not supported; the agent uses its own tools")
+			return
+		}
+		system, history, prompt, err := conversation(req.Messages)
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+
+		// A stored session already holds the conversation, so only the new
+		// user message may be sent, with the system messages for the turn.
+		sessionID := r.Header.Get(sessionHeader)
+		if sessionID != "" && len(history) > 0 {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "with "+sessionHeader+" the conversation is stored by the server; send only system messages and the new user message")
+			return
+		}
+		if sessionID != "" {
+			if err := t.agent.ClaimSession(r.Context(), sessionID); err != nil {
+				openAIFailure(w, err)
+				return
+			}
+		}
+		if err := t.meter.Check(r.Context()); err != nil {
+			openAIFailure(w, err)
+			return
+		}
+
+		var usage usageCounter
+		ctx := agent.WithUsageRecorder(userContext(r), usage.record)
+
+		// send runs the turn, streaming text to onText when it is non-nil
+		// and telling onFunctionCall of each tool call.
+		send := func(onText func(string) error, onFunctionCall func(string, map[string]any) error) ([]model.Content, error) {
+			ctx := agent.WithTurnInstruction(ctx, system)
+			if sessionID == "" {
+				return t.agent.SendMessages(ctx, history, prompt, onText, onFunctionCall)
+			}
+			if onText == nil {
+				return t.agent.Send(ctx, sessionID, prompt)
+			}
+			return nil, t.agent.SendStream(ctx, sessionID, prompt, onText, onFunctionCall, nil, nil)
+		}
+
+		completion := chatCompletion{
+			ID:      newCompletionID(),
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   t.model,
+		}
+		stop := "stop"
+
+		if !req.Stream {
+			contents, err := send(nil, nil)
+			if err != nil {
+				openAIFailure(w, err)
+				return
+			}
+			completion.Choices = []chatChoice{{
+				Message:      &assistantOutput{Role: "assistant", Content: modelText(contents)},
+				FinishReason: &stop,
+			}}
+			completion.Usage = usage.total()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(completion)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "streaming not supported")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		completion.Object = "chat.completion.chunk"
+		writeChunk := func(choices []chatChoice, usage *chatUsage) {
+			chunk := completion
+			chunk.Choices, chunk.Usage = choices, usage
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+
+		// Text written after a tool call is separated from earlier text as in
+		// modelText.
+		var wrote, called bool
+		writeChunk([]chatChoice{{Delta: &assistantDelta{Role: "assistant"}}}, nil)
+		_, err = send(func(text string) error {
+			if text == "" {
+				return nil
+			}
+			if wrote && called {
+				text = stepSeparator + text
+			}
+			wrote, called = true, false
+			writeChunk([]chatChoice{{Delta: &assistantDelta{Content: text}}}, nil)
+			return nil
+		}, func(string, map[string]any) error {
+			called = true
+			return nil
+		})
+		if err != nil {
+			// The status is already sent, so the error goes in the stream,
+			// as OpenAI does.
+			data, _ := json.Marshal(map[string]any{"error": map[string]any{"message": err.Error(), "type": "server_error"}})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+			return
+		}
+
+		writeChunk([]chatChoice{{Delta: &assistantDelta{}, FinishReason: &stop}}, nil)
+		if req.StreamOptions.IncludeUsage {
+			writeChunk([]chatChoice{}, usage.total())
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	}
+}
+
+// listModels serves the OpenAI models endpoint with the model of the
+// caller's tenant, for clients that check it before chatting.
+func listModels(ts *tenants) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+			return
+		}
+
+		t, ok := ts.forRequest(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"object": "list",
+			"data": []map[string]any{
+				{"id": t.model, "object": "model", "created": 0, "owned_by": t.name},
+			},
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/m2tx/agent_example/internal/quota"
+	"github.com/m2tx/agent_example/internal/tenant"
+)
+
+func TestModelText(t *testing.T) {
+	text := func(role string, texts ...string) model.Content {
+		c := model.Content{Role: role}
+		for _, s := range texts {
+			c.Parts = append(c.Parts, model.Part{Text: s})
+		}
+		return c
+	}
+	call := model.Content{Role: "model", Parts: []model.Part{{FunctionCall: &model.FunctionCall{Name: "get_weather"}}}}
+
+	tests := []struct {
+		name     string
+		contents []model.Content
+		want     string
+	}{
+		{"single answer", []model.Content{text("model", "Hello", ", world")}, "Hello, world"},
+		{"preamble before a tool call", []model.Content{text("model", "Let me check."), call, text("model", "It is sunny.")}, "Let me check.\n\nIt is sunny."},
+		{"prompt left out", []model.Content{text("user", "Weather?"), text("model", "Sunny.")}, "Sunny."},
+		{"trailing tool call", []model.Content{text("model", "It is sunny."), call}, "It is sunny."},
+		{"no text", []model.Content{call}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := modelText(tt.contents); got != tt.want {
+				t.Errorf("modelText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversation(t *testing.T) {
+	msg := func(role, content string) chatMessage {
+		return chatMessage{Role: role, Content: messageContent(content)}
+	}
+
+	system, history, prompt, err := conversation([]chatMessage{
+		msg("system", "Be brief."),
+		msg("user", "Hi"),
+		msg("assistant", "Hello!"),
+		msg("developer", "Answer in Portuguese."),
+		msg("user", "Who works in sales?"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system != "Be brief.\n\nAnswer in Portuguese." {
+		t.Errorf("system = %q", system)
+	}
+	if len(history) != 2 || history[0].Role != "user" || history[0].Parts[0].Text != "Hi" ||
+		history[1].Role != "model" || history[1].Parts[0].Text != "Hello!" {
+		t.Errorf("history = %+v", history)
+	}
+	if prompt != "Who works in sales?" {
+		t.Errorf("prompt = %q", prompt)
+	}
+
+	for name, messages := range map[string][]chatMessage{
+		"empty":               nil,
+		"last from the model": {msg("user", "Hi"), msg("assistant", "Hello!")},
+		"empty prompt":        {msg("user", "")},
+		"tool role":           {msg("tool", "{}"), msg("user", "Hi")},
+	} {
+		if _, _, _, err := conversation(messages); err == nil {
+			t.Errorf("%s: conversation accepted %+v", name, messages)
+		}
+	}
+}
+
+func TestMessageContent(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+		err     string
+	}{
+		{content: `"Hello"`, want: "Hello"},
+		{content: `null`, want: ""},
+		{content: `[]`, want: ""},
+		{content: `[{"type":"text","text":"Hello, "},{"type":"text","text":"world"}]`, want: "Hello, world"},
+		{content: `[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"data:"}}]`, err: `content part type "image_url" is not supported`},
+		{content: `42`, err: "content must be a string or an array of parts"},
+		{content: `{"text":"Hello"}`, err: "content must be a string or an array of parts"},
+	}
+	for _, tt := range tests {
+		var m chatMessage
+		err := json.Unmarshal([]byte(`{"role":"user","content":`+tt.content+`}`), &m)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("content %s: error = %v, want %q", tt.content, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || string(m.Content) != tt.want {
+			t.Errorf("content %s = %q, %v; want %q", tt.content, m.Content, err, tt.want)
+		}
+	}
+}
+
+// toolCallingProvider writes a preamble, calls a tool and then answers.
+type toolCallingProvider struct{}
+
+func (toolCallingProvider) Send(ctx context.Context, req agent.ProviderRequest) ([]model.Content, error) {
+	return toolCallingProvider{}.SendStream(ctx, req, func(string) error { return nil }, nil, nil)
+}
+
+func (toolCallingProvider) SendStream(ctx context.Context, req agent.ProviderRequest, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error) ([]model.Content, error) {
+	if err := onText("Let me check."); err != nil {
+		return nil, err
+	}
+	if onFunctionCall != nil {
+		if err := onFunctionCall("get_weather", nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, text := range []string{"It is ", "sunny."} {
+		if err := onText(text); err != nil {
+			return nil, err
+		}
+	}
+	return []model.Content{
+		{Role: "user", Parts: []model.Part{{Text: req.Prompt}}},
+		{Role: "model", Parts: []model.Part{{Text: "Let me check."}, {FunctionCall: &model.FunctionCall{Name: "get_weather"}}}},
+		{Role: "user", Parts: []model.Part{{FunctionResponse: &model.FunctionResponse{Name: "get_weather"}}}},
+		{Role: "model", Parts: []model.Part{{Text: "It is sunny."}}},
+	}, nil
+}
+
+func TestChatCompletionsStreamMatchesWhole(t *testing.T) {
+	ts := &tenants{
+		config: &tenant.Config{Default: "t", Tenants: map[string]tenant.Tenant{"t": {}}},
+		agents: map[string]*tenantAgent{"t": {
+			name:  "t",
+			model: "test-model",
+			agent: agent.New(toolCallingProvider{}, "You are helpful."),
+			meter: quota.NewMeter("t", quota.Budget{}, nil, nil),
+		}},
+	}
+	handler := chatCompletions(ts, func(*http.Request) error { return nil })
+
+	post := func(stream bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{
+			"model":    "agent",
+			"stream":   stream,
+			"messages": []map[string]any{{"role": "user", "content": "Weather?"}},
+		})
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(string(body))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("stream=%v: status %d: %s", stream, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	const want = "Let me check.\n\nIt is sunny."
+
+	var whole chatCompletion
+	if err := json.NewDecoder(post(false).Body).Decode(&whole); err != nil {
+		t.Fatal(err)
+	}
+	if len(whole.Choices) != 1 || whole.Choices[0].Message.Content != want {
+		t.Errorf("completion = %+v, want content %q", whole.Choices, want)
+	}
+
+	var streamed strings.Builder
+	for line := range strings.Lines(post(true).Body.String()) {
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("chunk %q: %v", data, err)
+		}
+		for _, c := range chunk.Choices {
+			streamed.WriteString(c.Delta.Content)
+		}
+	}
+	if streamed.String() != want {
+		t.Errorf("streamed content = %q, want %q", streamed.String(), want)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/m2tx/agent_example/assets"
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/functions"
+	"github.com/m2tx/agent_example/internal/mcp"
+	"github.com/m2tx/agent_example/internal/mcpserver"
+	"github.com/m2tx/agent_example/internal/quota"
+	"github.com/m2tx/agent_example/internal/repository"
+	"github.com/m2tx/agent_example/internal/tenant"
+	"github.com/m2tx/agent_example/internal/vectorstore"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tenantAgent is the agent of one tenant with everything it owns: its
+// provider, documents, MCP connections and, when the agent is served over
+// MCP, its MCP server.
+type tenantAgent struct {
+	name     string
+	model    string
+	agent    *agent.Agent
+	provider agent.LLMProvider
+	embedder *agent.Embedder
+	mcp      *mcp.Manager
+
+	// meter enforces the tenant's daily budget on every model call.
+	meter *quota.Meter
+
+	// tools are the built-in tools enabled for the tenant.
+	tools []*agent.FunctionDeclaration
+
+	mcpServer  *mcpserver.Server
+	mcpHandler http.Handler
+
+	// indexed is closed once the document index is built; until then the
+	// tenant is not ready.
+	indexed  chan struct{}
+	indexErr error
+}
+
+// builtinTools creates the built-in tools in registration order.
+func builtinTools(embedder *agent.Embedder) []*agent.FunctionDeclaration {
+	return []*agent.FunctionDeclaration{
+		functions.CreateWeatherFunctionDeclaration(),
+		functions.CreateCompanyFunctionDeclaration(),
+		functions.CreateCollaboratorsFunctionDeclaration(),
+		functions.CreateDocsSearchFunctionDeclaration(embedder),
+	}
+}
+
+// newTenantAgent builds and connects the agent of tenant cfg. Fields left
+// empty in cfg fall back to the environment configuration.
+func newTenantAgent(ctx context.Context, cfg tenant.Tenant, mcpConfig *mcp.Config, database *mongo.Database, spend quota.Store, prices quota.Prices) (*tenantAgent, error) {
+	t := &tenantAgent{name: cfg.Name, indexed: make(chan struct{})}
+
+	switch cmp.Or(cfg.Docs.Store, getVectorStore()) {
+	case "mongodb":
+		// The shared index is populated out of band by cmd/ingest.
+		store := vectorstore.NewMongoVectorStore(database, cmp.Or(cfg.Docs.Collection, getVectorCollection()), cmp.Or(cfg.Docs.Index, getVectorIndex()))
+		t.embedder = agent.NewEmbedderWithStore(store)
+		close(t.indexed)
+	default:
+		t.embedder = agent.NewEmbedder()
+		dir := cmp.Or(cfg.Docs.Dir, getDocsDir())
+		go func() {
+			defer close(t.indexed)
+			if err := t.embedder.Index(ctx, dir); err != nil {
+				log.Printf("tenant %q: embedder: index %q: %v", t.name, dir, err)
+				t.indexErr = err
+			}
+		}()
+	}
+
+	providerName := cmp.Or(cfg.Provider, getProviderName())
+	model := cmp.Or(cfg.Model, defaultModel(providerName))
+	t.model = model
+	provider, err := buildProvider(ctx, providerName, model)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", t.name, err)
+	}
+	// Turns, MCP chat and sampling all count against the tenant's budget.
+	t.meter = quota.NewMeter(t.name, cmp.Or(cfg.Quota, getDailyBudget()), spend, prices)
+	provider = t.meter.Provider(provider)
+	t.provider = provider
+
+	sessions := "sessions"
+	if cfg.SessionNamespace != "" {
+		sessions += "_" + cfg.SessionNamespace
+	}
+	repo := repository.NewMongoSessionRepository(database, sessions)
+
+	t.agent = agent.NewWithRepo(provider, cmp.Or(cfg.SystemInstruction, assets.SystemInstruction), repo)
+
+	// Built-in tools are registered first so that MCP servers cannot silently
+	// replace them; collisions are resolved by each server's onCollision policy.
+	tools := builtinTools(t.embedder)
+	for _, name := range cfg.Tools {
+		if !slices.ContainsFunc(tools, func(d *agent.FunctionDeclaration) bool { return d.Name == name }) {
+			return nil, fmt.Errorf("tenant %q: unknown tool %q", t.name, name)
+		}
+	}
+	for _, decl := range tools {
+		if cfg.Tools != nil && !slices.Contains(cfg.Tools, decl.Name) {
+			continue
+		}
+		if err := t.agent.AddFunctionCall(decl); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", t.name, err)
+		}
+		t.tools = append(t.tools, decl)
+	}
+
+	t.mcp, err = mcp.Connect(ctx, mcpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", t.name, err)
+	}
+
+	t.mcp.SetSampler(&mcp.Sampler{
+		Provider:     provider,
+		DefaultModel: model,
+		Approve: func(ctx context.Context, server string, params *mcpsdk.CreateMessageParams) error {
+			if !cfg.Sampling.Allows(server) {
+				return fmt.Errorf("tenant %q does not allow sampling by server %q", t.name, server)
+			}
+			log.Printf("tenant %q: mcp: server %q requested sampling (%d messages, max %d tokens)", t.name, server, len(params.Messages), params.MaxTokens)
+			return nil
+		},
+	})
+
+	if err := t.register(ctx); err != nil {
+		t.mcp.Close()
+		return nil, fmt.Errorf("tenant %q: %w", t.name, err)
+	}
+
+	return t, nil
+}
+
+// register adds the tools, prompts and resources of the tenant's MCP
+// servers to its agent.
+func (t *tenantAgent) register(ctx context.Context) error {
+	if err := t.mcp.RegisterTools(ctx, t.agent); err != nil {
+		return err
+	}
+	if err := t.mcp.RegisterPrompts(ctx, t.agent); err != nil {
+		return err
+	}
+	return t.mcp.RegisterResources(ctx, t.agent, t.agent)
+}
+
+// mcpTools are the built-in tools re-exported when the agent is served over
+// MCP, if the tenant enables them.
+var mcpTools = []string{"search_docs", "get_collaborators"}
+
+// serveMCP creates the MCP server publishing the tenant's agent, its
+// documents and some of its built-in tools.
+func (t *tenantAgent) serveMCP() {
+	var tools []*agent.FunctionDeclaration
+	for _, decl := range t.tools {
+		if slices.Contains(mcpTools, decl.Name) {
+			tools = append(tools, decl)
+		}
+	}
+	t.mcpServer = mcpserver.New(t.agent, t.embedder, tools...)
+	t.mcpHandler = t.mcpServer.Handler()
+}
+
+// documentsReady reports whether the tenant's documents are indexed and
+// searchable.
+func (t *tenantAgent) documentsReady(ctx context.Context) error {
+	select {
+	case <-t.indexed:
+	default:
+		return errors.New("documents are still being indexed")
+	}
+	if t.indexErr != nil {
+		return t.indexErr
+	}
+	_, err := t.embedder.Len(ctx)
+	return err
+}
+
+// syncDocuments republishes the document list to MCP clients, if the agent
+// is served over MCP.
+func (t *tenantAgent) syncDocuments(ctx context.Context) {
+	if t.mcpServer == nil {
+		return
+	}
+	if err := t.mcpServer.SyncDocuments(ctx); err != nil {
+		log.Printf("tenant %q: mcp server: %v", t.name, err)
+	}
+}
+
+// tenants routes requests to the agent of their tenant.
+type tenants struct {
+	config *tenant.Config
+	agents map[string]*tenantAgent
+}
+
+// newTenants builds the agent of every tenant in cfg. mcpConfigs holds the
+// MCP configuration of each tenant; spend and prices meter their usage.
+func newTenants(ctx context.Context, cfg *tenant.Config, mcpConfigs map[string]*mcp.Config, database *mongo.Database, spend quota.Store, prices quota.Prices) (*tenants, error) {
+	ts := &tenants{config: cfg, agents: make(map[string]*tenantAgent, len(cfg.Tenants))}
+	for _, name := range cfg.Names() {
+		t, err := newTenantAgent(ctx, cfg.Tenants[name], mcpConfigs[name], database, spend, prices)
+		if err != nil {
+			ts.close()
+			return nil, err
+		}
+		ts.agents[name] = t
+	}
+	return ts, nil
+}
+
+// list returns the tenants sorted by name.
+func (ts *tenants) list() []*tenantAgent {
+	list := make([]*tenantAgent, 0, len(ts.agents))
+	for _, name := range ts.config.Names() {
+		if t, ok := ts.agents[name]; ok {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// defaultAgent returns the tenant serving requests that name none, if any.
+func (ts *tenants) defaultAgent() (*tenantAgent, bool) {
+	t, ok := ts.agents[ts.config.Default]
+	return t, ok
+}
+
+// forRequest returns the tenant of r, or writes 404 for an unknown tenant
+// and 403 for a tenant the caller's credentials do not belong to.
+func (ts *tenants) forRequest(w http.ResponseWriter, r *http.Request) (*tenantAgent, bool) {
+	name, err := ts.config.Resolve(r)
+	if errors.Is(err, tenant.ErrTenantForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return ts.agents[name], true
+}
+
+// close terminates the MCP sessions of every tenant.
+func (ts *tenants) close() {
+	for _, t := range ts.agents {
+		t.mcp.Close()
+	}
+}
@@ -0,0 +1,206 @@
+// Package events defines the server-sent events streamed by POST /prompt.
+//
+// Every event is one SSE frame whose event field names its type and whose
+// data is the JSON encoding of the matching struct, with the type repeated
+// in a "type" member for clients that only read data lines:
+//
+//	id: msg_1f2e3d4c5b6a7988:3
+//	event: tool_call
+//	data: {"type":"tool_call","id":"call_0a1b2c3d4e5f6071","name":"get_weather","args":{"city":"London"}}
+//
+// A turn starts with MessageStart and always ends with MessageEnd. Frame
+// IDs are the message ID followed by the frame's sequence number. Comment
+// frames (": ping") are sent while the stream is idle to keep proxies from
+// closing it; clients must ignore them.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/m2tx/agent_example/internal/model"
+)
+
+// Version is the version of the protocol described by this package. Version
+// 1 was the untyped {"type","content"} protocol.
+const Version = 2
+
+// Type names an event.
+type Type string
+
+const (
+	TypeMessageStart Type = "message_start"
+	TypeCommand      Type = "command"
+	TypeText         Type = "text"
+	TypeToolCall     Type = "tool_call"
+	TypeToolProgress Type = "tool_progress"
+	TypeToolResult   Type = "tool_result"
+	TypeElicitation  Type = "elicitation"
+	TypeTurnDone     Type = "turn_done"
+	TypeCitations    Type = "citations"
+	TypeUsage        Type = "usage"
+	TypeError        Type = "error"
+	TypeMessageEnd   Type = "message_end"
+)
+
+// Event is implemented by every event struct.
+type Event interface {
+	EventType() Type
+}
+
+// MessageStart opens the stream of a turn.
+type MessageStart struct {
+	Version   int    `json:"version"`
+	MessageID string `json:"message_id"`
+	SessionID string `json:"session_id"`
+	Tenant    string `json:"tenant,omitempty"`
+	Model     string `json:"model,omitempty"`
+}
+
+// Command reports that the prompt was a slash command: Turns were added to
+// the session and Prompt was sent in its place.
+type Command struct {
+	Turns  []model.Content `json:"turns"`
+	Prompt string          `json:"prompt"`
+}
+
+// Text is a chunk of the model's answer.
+type Text struct {
+	Text string `json:"text"`
+}
+
+// ToolCall reports a tool call the model made, before it runs.
+type ToolCall struct {
+	ID   string         `json:"id"`
+	Name string         `json:"name"`
+	Args map[string]any `json:"args"`
+}
+
+// ToolProgress is a progress update from an MCP server running a tool call.
+// Total is zero when the server does not know how much work remains.
+type ToolProgress struct {
+	CallID   string  `json:"call_id,omitempty"`
+	Tool     string  `json:"tool"`
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// ToolResult reports the outcome of the ToolCall with the same ID: its
+// result, or the error it failed with.
+type ToolResult struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	Result     map[string]any `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	DurationMS float64        `json:"duration_ms"`
+}
+
+// Elicitation is a request for user input from an MCP server. It is
+// answered with POST /elicitations/{id}.
+type Elicitation struct {
+	ID      string `json:"id"`
+	Server  string `json:"server"`
+	Message string `json:"message"`
+	Schema  any    `json:"schema,omitempty"`
+}
+
+// TurnDone reports that the model stopped generating; tool calls may follow.
+type TurnDone struct{}
+
+// Citations lists the sources of the answer, numbered as cited in its text.
+type Citations struct {
+	Citations []model.Citation `json:"citations"`
+}
+
+// Usage reports the tokens used by one model call. In MessageEnd it holds
+// the totals of the turn and Model is empty.
+type Usage struct {
+	Model        string `json:"model,omitempty"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+// Error codes.
+const (
+	CodeInternal     = "internal"
+	CodeRateLimited  = "rate_limited"
+	CodeForbidden    = "forbidden"
+	CodeShuttingDown = "shutting_down"
+)
+
+// Error reports why the turn failed. RetryAfter, in seconds, is set for
+// CodeRateLimited.
+type Error struct {
+	Code       string  `json:"code"`
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after,omitempty"`
+}
+
+// StopReason tells why a turn ended.
+type StopReason string
+
+const (
+	StopEndTurn   StopReason = "end_turn"
+	StopCancelled StopReason = "cancelled"
+	StopError     StopReason = "error"
+	StopShutdown  StopReason = "shutdown"
+)
+
+// MessageEnd closes the stream of a turn.
+type MessageEnd struct {
+	MessageID  string     `json:"message_id"`
+	StopReason StopReason `json:"stop_reason"`
+	Usage      Usage      `json:"usage"`
+	DurationMS float64    `json:"duration_ms"`
+}
+
+func (MessageStart) EventType() Type { return TypeMessageStart }
+func (Command) EventType() Type      { return TypeCommand }
+func (Text) EventType() Type         { return TypeText }
+func (ToolCall) EventType() Type     { return TypeToolCall }
+func (ToolProgress) EventType() Type { return TypeToolProgress }
+func (ToolResult) EventType() Type   { return TypeToolResult }
+func (Elicitation) EventType() Type  { return TypeElicitation }
+func (TurnDone) EventType() Type     { return TypeTurnDone }
+func (Citations) EventType() Type    { return TypeCitations }
+func (Usage) EventType() Type        { return TypeUsage }
+func (Error) EventType() Type        { return TypeError }
+func (MessageEnd) EventType() Type   { return TypeMessageEnd }
+
+// Decode parses the data of a frame whose event field is t.
+func Decode(t Type, data []byte) (Event, error) {
+	var e Event
+	switch t {
+	case TypeMessageStart:
+		e = &MessageStart{}
+	case TypeCommand:
+		e = &Command{}
+	case TypeText:
+		e = &Text{}
+	case TypeToolCall:
+		e = &ToolCall{}
+	case TypeToolProgress:
+		e = &ToolProgress{}
+	case TypeToolResult:
+		e = &ToolResult{}
+	case TypeElicitation:
+		e = &Elicitation{}
+	case TypeTurnDone:
+		e = &TurnDone{}
+	case TypeCitations:
+		e = &Citations{}
+	case TypeUsage:
+		e = &Usage{}
+	case TypeError:
+		e = &Error{}
+	case TypeMessageEnd:
+		e = &MessageEnd{}
+	default:
+		return nil, fmt.Errorf("events: unknown event type %q", t)
+	}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("events: decode %s: %w", t, err)
+	}
+	return e, nil
+}
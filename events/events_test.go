@@ -0,0 +1,61 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/model"
+)
+
+func TestDecode(t *testing.T) {
+	events := []Event{
+		MessageStart{Version: Version, MessageID: "msg_1", SessionID: "s", Tenant: "hr", Model: "m"},
+		Command{Turns: []model.Content{{Role: "user", Parts: []model.Part{{Text: "Summarize"}}}}, Prompt: "Go"},
+		Text{Text: "Hello"},
+		ToolCall{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "London"}},
+		ToolProgress{CallID: "call_1", Tool: "get_weather", Progress: 1, Total: 2, Message: "half way"},
+		ToolResult{ID: "call_1", Name: "get_weather", Result: map[string]any{"celsius": 21.0}, DurationMS: 12.5},
+		ToolResult{ID: "call_2", Name: "get_weather", Error: "timeout"},
+		Elicitation{ID: "e1", Server: "wiki", Message: "Delete?", Schema: map[string]any{"type": "object"}},
+		TurnDone{},
+		Citations{Citations: []model.Citation{{Index: 1, DocumentID: "d1", Filename: "vacation.md", Snippet: "30 days"}}},
+		Usage{Model: "m", InputTokens: 10, OutputTokens: 5},
+		Error{Code: CodeRateLimited, Message: "slow down", RetryAfter: 30},
+		MessageEnd{MessageID: "msg_1", StopReason: StopEndTurn, Usage: Usage{InputTokens: 10, OutputTokens: 5}, DurationMS: 100},
+	}
+
+	seen := map[Type]bool{}
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := Decode(e.EventType(), data)
+		if err != nil {
+			t.Fatalf("Decode(%s, %s): %v", e.EventType(), data, err)
+		}
+		if got := reflect.ValueOf(decoded).Elem().Interface(); !reflect.DeepEqual(got, e) {
+			t.Errorf("%s round trip = %+v, want %+v", e.EventType(), got, e)
+		}
+		seen[e.EventType()] = true
+	}
+	if len(seen) != 12 {
+		t.Errorf("round-tripped %d event types, want all 12", len(seen))
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode("bogus", []byte(`{}`)); err == nil {
+		t.Error("Decode accepted an unknown type")
+	}
+	if _, err := Decode(TypeText, []byte(`{"text":1}`)); err == nil {
+		t.Error("Decode accepted invalid data")
+	}
+
+	// Unknown members, such as the type written by Writer, are ignored.
+	e, err := Decode(TypeText, []byte(`{"type":"text","text":"hi","future":true}`))
+	if err != nil || e.(*Text).Text != "hi" {
+		t.Errorf("Decode = %+v, %v", e, err)
+	}
+}
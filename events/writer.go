@@ -0,0 +1,97 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Writer writes the events of one turn to an SSE stream. It is safe for
+// concurrent use, since MCP servers report progress and ask for input from
+// their own goroutines while a tool call runs.
+type Writer struct {
+	mu        sync.Mutex
+	w         io.Writer
+	flush     func()
+	messageID string
+	seq       int
+	last      time.Time
+}
+
+// NewWriter creates a writer for the turn messageID. flush, if non-nil, is
+// called after every frame.
+func NewWriter(w io.Writer, flush func(), messageID string) *Writer {
+	return &Writer{w: w, flush: flush, messageID: messageID}
+}
+
+// Send writes e as the next frame.
+func (w *Writer) Send(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("events: encode %s: %w", e.EventType(), err)
+	}
+	// Prepend the type to the object's members.
+	typed := fmt.Sprintf(`{"type":%q`, e.EventType())
+	if len(data) > 2 {
+		typed += ","
+	}
+	data = append([]byte(typed), data[1:]...)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	_, err = fmt.Fprintf(w.w, "id: %s:%d\nevent: %s\ndata: %s\n\n", w.messageID, w.seq, e.EventType(), data)
+	w.done()
+	return err
+}
+
+// Heartbeat writes a comment frame if nothing was written for interval.
+func (w *Writer) Heartbeat(interval time.Duration) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if time.Since(w.last) < interval {
+		return nil
+	}
+	_, err := io.WriteString(w.w, ": ping\n\n")
+	w.done()
+	return err
+}
+
+// done records a write and flushes it. w.mu must be held.
+func (w *Writer) done() {
+	w.last = time.Now()
+	if w.flush != nil {
+		w.flush()
+	}
+}
+
+// KeepAlive sends heartbeats while the stream is idle for interval, until
+// the returned function is called. The function waits for the last
+// heartbeat to be written, so the stream may be closed after it returns.
+func (w *Writer) KeepAlive(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := w.Heartbeat(interval); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
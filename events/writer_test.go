@@ -0,0 +1,170 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// frame is one parsed SSE frame.
+type frame struct {
+	id, event, data string
+}
+
+func parseFrames(t *testing.T, stream string) []frame {
+	t.Helper()
+	if !strings.HasSuffix(stream, "\n\n") {
+		t.Fatalf("stream does not end with a blank line: %q", stream)
+	}
+	var frames []frame
+	for block := range strings.SplitSeq(strings.TrimSuffix(stream, "\n\n"), "\n\n") {
+		var f frame
+		for line := range strings.SplitSeq(block, "\n") {
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "id":
+				f.id = value
+			case "event":
+				f.event = value
+			case "data":
+				f.data = value
+			case "":
+				// Comment.
+			default:
+				t.Fatalf("unexpected line %q", line)
+			}
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+func TestWriterSend(t *testing.T) {
+	var buf bytes.Buffer
+	flushes := 0
+	w := NewWriter(&buf, func() { flushes++ }, "msg_1")
+
+	sent := []Event{
+		MessageStart{Version: Version, MessageID: "msg_1", SessionID: "s"},
+		Text{Text: "line one\nline two"},
+		ToolCall{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "London"}},
+		TurnDone{},
+		MessageEnd{MessageID: "msg_1", StopReason: StopEndTurn, Usage: Usage{InputTokens: 3, OutputTokens: 4}},
+	}
+	for _, e := range sent {
+		if err := w.Send(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if flushes != len(sent) {
+		t.Errorf("flushed %d times, want once per frame (%d)", flushes, len(sent))
+	}
+
+	frames := parseFrames(t, buf.String())
+	if len(frames) != len(sent) {
+		t.Fatalf("got %d frames, want %d:\n%s", len(frames), len(sent), buf.String())
+	}
+	for i, f := range frames {
+		e := sent[i]
+		if want := fmt.Sprintf("msg_1:%d", i+1); f.id != want {
+			t.Errorf("frame %d id = %q, want %q", i, f.id, want)
+		}
+		if f.event != string(e.EventType()) {
+			t.Errorf("frame %d event = %q, want %q", i, f.event, e.EventType())
+		}
+
+		var typed struct {
+			Type Type `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(f.data), &typed); err != nil || typed.Type != e.EventType() {
+			t.Errorf("frame %d data %s: type = %q, %v; want %q", i, f.data, typed.Type, err, e.EventType())
+		}
+
+		decoded, err := Decode(Type(f.event), []byte(f.data))
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if got := reflect.ValueOf(decoded).Elem().Interface(); !reflect.DeepEqual(got, e) {
+			t.Errorf("frame %d decoded to %+v, want %+v", i, got, e)
+		}
+	}
+
+	if frames[3].data != `{"type":"turn_done"}` {
+		t.Errorf("empty event data = %s", frames[3].data)
+	}
+}
+
+func TestWriterHeartbeat(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil, "msg_1")
+
+	if err := w.Send(Text{Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := w.Heartbeat(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("heartbeat right after a frame wrote %q", buf.String())
+	}
+
+	if err := w.Heartbeat(0); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != ": ping\n\n" {
+		t.Errorf("heartbeat on an idle stream wrote %q", buf.String())
+	}
+
+	// Heartbeats do not take a sequence number.
+	buf.Reset()
+	w.Send(Text{Text: "again"})
+	if f := parseFrames(t, buf.String()); f[0].id != "msg_1:2" {
+		t.Errorf("frame after heartbeat id = %q, want msg_1:2", f[0].id)
+	}
+}
+
+// lockedBuffer lets the test read what KeepAlive's goroutine writes.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWriterKeepAlive(t *testing.T) {
+	var buf lockedBuffer
+	w := NewWriter(&buf, nil, "msg_1")
+
+	stop := w.KeepAlive(10 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), ": ping\n\n") {
+		if time.Now().After(deadline) {
+			t.Fatal("no heartbeat on an idle stream")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+
+	// Nothing is written once stop returns.
+	written := buf.String()
+	time.Sleep(50 * time.Millisecond)
+	if buf.String() != written {
+		t.Error("heartbeat written after stop")
+	}
+}
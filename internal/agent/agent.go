@@ -2,15 +2,35 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
-
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m2tx/agent_example/internal/auth"
 	"github.com/m2tx/agent_example/internal/model"
 	"github.com/m2tx/agent_example/internal/repository"
 )
 
+// ErrSessionForbidden is returned for sessions owned by another principal.
+var ErrSessionForbidden = repository.ErrSessionOwned
+
 type contextKey int
 
-const sessionIDKey contextKey = iota
+const (
+	sessionIDKey contextKey = iota
+	citationsKey
+	partsKey
+	userTokenKey
+	usageKey
+	toolObserverKey
+	precedingTurnsKey
+	turnInstructionKey
+)
 
 // WithSessionID returns a context carrying the given session ID.
 func WithSessionID(ctx context.Context, sessionID string) context.Context {
@@ -23,11 +43,66 @@ func SessionIDFromContext(ctx context.Context) (string, bool) {
 	return v, ok
 }
 
+// WithUserToken returns a context carrying the end user's identity token,
+// which tools may forward to the services they call on the user's behalf.
+func WithUserToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, userTokenKey, token)
+}
+
+// UserTokenFromContext extracts the token stored by WithUserToken.
+func UserTokenFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(userTokenKey).(string)
+	return v, ok && v != ""
+}
+
+// WithPrecedingTurns returns a context whose turn adds contents to the
+// session history before its prompt, such as the turns a slash command
+// injects. They are saved with the turn's result, so a turn that fails
+// leaves no unanswered turns in the session.
+func WithPrecedingTurns(ctx context.Context, contents ...model.Content) context.Context {
+	return context.WithValue(ctx, precedingTurnsKey, contents)
+}
+
+// turnHistory loads the history a turn of sessionID starts from, including
+// the turns added with WithPrecedingTurns.
+func (a *Agent) turnHistory(ctx context.Context, sessionID string) ([]model.Content, error) {
+	history, err := a.loadHistory(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	preceding, _ := ctx.Value(precedingTurnsKey).([]model.Content)
+	return append(history, preceding...), nil
+}
+
+// WithTurnInstruction returns a context whose turn appends text to the
+// system instruction, such as the system message of an API request. It only
+// applies to that turn and is not saved in the session.
+func WithTurnInstruction(ctx context.Context, text string) context.Context {
+	return context.WithValue(ctx, turnInstructionKey, text)
+}
+
+// turnInstruction returns the system instruction of a turn, including the
+// text added with WithTurnInstruction.
+func (a *Agent) turnInstruction(ctx context.Context) string {
+	instruction := a.instruction()
+	if text, _ := ctx.Value(turnInstructionKey).(string); text != "" {
+		instruction += "\n\n" + text
+	}
+	return instruction
+}
+
 type Agent struct {
 	provider          LLMProvider
 	systemInstruction string
+	functionsMu       sync.RWMutex
 	functionsMap      map[string]*FunctionDeclaration
 	sessionRepository repository.SessionRepository
+
+	instructionsMu      sync.RWMutex
+	instructionSections map[string]string
+
+	turnsMu sync.Mutex
+	turns   map[string]map[*context.CancelFunc]struct{}
 }
 
 type FunctionDeclaration struct {
@@ -54,7 +129,96 @@ func NewWithRepo(provider LLMProvider, systemInstruction string, sessionReposito
 	return a
 }
 
+// ErrFunctionExists is returned by AddFunctionCall when a function with the
+// same name is already registered.
+var ErrFunctionExists = errors.New("function already registered")
+
+// AddFunctionCall registers a new function. It returns ErrFunctionExists if
+// the name is already taken; use SetFunctionCall to replace an existing entry.
 func (a *Agent) AddFunctionCall(functionDeclaration *FunctionDeclaration) error {
+	if err := validateFunctionDeclaration(functionDeclaration); err != nil {
+		return err
+	}
+
+	a.functionsMu.Lock()
+	defer a.functionsMu.Unlock()
+
+	if _, exists := a.functionsMap[functionDeclaration.Name]; exists {
+		return fmt.Errorf("function %s: %w", functionDeclaration.Name, ErrFunctionExists)
+	}
+
+	a.functionsMap[functionDeclaration.Name] = functionDeclaration
+
+	return nil
+}
+
+// SetFunctionCall registers a function, replacing any existing one with the same name.
+func (a *Agent) SetFunctionCall(functionDeclaration *FunctionDeclaration) error {
+	if err := validateFunctionDeclaration(functionDeclaration); err != nil {
+		return err
+	}
+
+	a.functionsMu.Lock()
+	defer a.functionsMu.Unlock()
+
+	a.functionsMap[functionDeclaration.Name] = functionDeclaration
+
+	return nil
+}
+
+// RemoveFunctionCall unregisters a function. Turns already in progress keep
+// the tool list they started with, but further calls to the removed function
+// fail. Is a no-op if the function does not exist.
+func (a *Agent) RemoveFunctionCall(name string) {
+	a.functionsMu.Lock()
+	defer a.functionsMu.Unlock()
+
+	delete(a.functionsMap, name)
+}
+
+// functions returns a snapshot of the registered functions for a single turn.
+func (a *Agent) functions() map[string]*FunctionDeclaration {
+	a.functionsMu.RLock()
+	defer a.functionsMu.RUnlock()
+
+	return maps.Clone(a.functionsMap)
+}
+
+// SetInstructionSection appends a named block of text to the system
+// instruction, replacing any earlier block with the same name. An empty text
+// removes the block. Sections are appended in name order, after the base
+// instruction, starting with the next turn.
+func (a *Agent) SetInstructionSection(name, text string) {
+	a.instructionsMu.Lock()
+	defer a.instructionsMu.Unlock()
+
+	if text == "" {
+		delete(a.instructionSections, name)
+		return
+	}
+	if a.instructionSections == nil {
+		a.instructionSections = make(map[string]string)
+	}
+	a.instructionSections[name] = text
+}
+
+// instruction returns the base system instruction followed by every section.
+func (a *Agent) instruction() string {
+	a.instructionsMu.RLock()
+	defer a.instructionsMu.RUnlock()
+
+	if len(a.instructionSections) == 0 {
+		return a.systemInstruction
+	}
+
+	parts := []string{a.systemInstruction}
+	for _, name := range slices.Sorted(maps.Keys(a.instructionSections)) {
+		parts = append(parts, a.instructionSections[name])
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func validateFunctionDeclaration(functionDeclaration *FunctionDeclaration) error {
 	if functionDeclaration == nil {
 		return fmt.Errorf("function declaration cannot be nil")
 	}
@@ -67,16 +231,42 @@ func (a *Agent) AddFunctionCall(functionDeclaration *FunctionDeclaration) error
 		return fmt.Errorf("function call implementation cannot be nil")
 	}
 
-	a.functionsMap[functionDeclaration.Name] = functionDeclaration
-
 	return nil
 }
 
-func (a *Agent) handleFunctionCall(ctx context.Context, name string, args map[string]any) (map[string]any, error) {
-	if fd, exists := a.functionsMap[name]; exists {
-		return fd.FunctionCall(ctx, args)
+// handleFunctionCall runs a function call requested by the model, reporting
+// it to the ToolObserver on ctx, if any.
+func (a *Agent) handleFunctionCall(ctx context.Context, name string, args map[string]any) (FunctionResult, error) {
+	observer, _ := ctx.Value(toolObserverKey).(ToolObserver)
+	call := ToolCall{ID: newToolCallID(), Name: name, Args: args}
+	ctx = context.WithValue(ctx, toolCallIDKey{}, call.ID)
+
+	if observer.OnCall != nil {
+		observer.OnCall(call)
+	}
+	start := time.Now()
+	result, err := a.callFunction(ctx, name, args)
+	if observer.OnResult != nil {
+		observer.OnResult(ToolResult{ID: call.ID, Name: name, Response: result.Response, Err: err, Duration: time.Since(start)})
+	}
+	return result, err
+}
+
+func (a *Agent) callFunction(ctx context.Context, name string, args map[string]any) (FunctionResult, error) {
+	a.functionsMu.RLock()
+	fd, exists := a.functionsMap[name]
+	a.functionsMu.RUnlock()
+
+	if !exists {
+		return FunctionResult{}, fmt.Errorf("function %s not found", name)
+	}
+
+	ctx, parts := withPartCollector(ctx)
+	response, err := fd.FunctionCall(ctx, args)
+	if err != nil {
+		return FunctionResult{}, err
 	}
-	return nil, fmt.Errorf("function %s not found", name)
+	return FunctionResult{Response: response, Parts: parts.list()}, nil
 }
 
 func (a *Agent) loadHistory(ctx context.Context, sessionID string) ([]model.Content, error) {
@@ -95,31 +285,94 @@ func (a *Agent) saveHistory(ctx context.Context, sessionID string, history []mod
 		return
 	}
 	if err := a.sessionRepository.Save(ctx, sessionID, history); err != nil {
-		fmt.Printf("agent: warning: failed to save session %q: %v\n", sessionID, err)
+		log.Printf("agent: warning: failed to save session %q: %v", sessionID, err)
+	}
+}
+
+// savePartial records a turn that was cancelled before the model finished,
+// such as when the server shuts down: the prompt and whatever text had been
+// streamed are appended to the history, so the conversation can continue.
+func (a *Agent) savePartial(ctx context.Context, sessionID string, history []model.Content, prompt string, text string) {
+	history = append(history, model.Content{Role: "user", Parts: []model.Part{{Text: prompt}}})
+	if text != "" {
+		history = append(history, model.Content{Role: "model", Parts: []model.Part{{Text: text}}})
+	}
+	a.saveHistory(context.WithoutCancel(ctx), sessionID, history)
+}
+
+// startTurn registers a cancellable turn for sessionID. The returned function
+// must be called when the turn ends.
+func (a *Agent) startTurn(ctx context.Context, sessionID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	a.turnsMu.Lock()
+	defer a.turnsMu.Unlock()
+
+	if a.turns == nil {
+		a.turns = make(map[string]map[*context.CancelFunc]struct{})
+	}
+	if a.turns[sessionID] == nil {
+		a.turns[sessionID] = make(map[*context.CancelFunc]struct{})
+	}
+	key := &cancel
+	a.turns[sessionID][key] = struct{}{}
+
+	return ctx, func() {
+		a.turnsMu.Lock()
+		defer a.turnsMu.Unlock()
+
+		delete(a.turns[sessionID], key)
+		if len(a.turns[sessionID]) == 0 {
+			delete(a.turns, sessionID)
+		}
+		cancel()
+	}
+}
+
+// Cancel stops the turns running for sessionID, including the tool calls they
+// are waiting on. It reports whether any turn was running.
+func (a *Agent) Cancel(sessionID string) bool {
+	a.turnsMu.Lock()
+	defer a.turnsMu.Unlock()
+
+	for cancel := range a.turns[sessionID] {
+		(*cancel)()
 	}
+	return len(a.turns[sessionID]) > 0
 }
 
 func (a *Agent) Send(ctx context.Context, sessionID string, prompt string) ([]model.Content, error) {
+	ctx, done := a.startTurn(ctx, sessionID)
+	defer done()
 	ctx = WithSessionID(ctx, sessionID)
+	ctx, citations := withCitationCollector(ctx)
 
-	history, err := a.loadHistory(ctx, sessionID)
+	if err := a.ClaimSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	history, err := a.turnHistory(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
 
 	req := ProviderRequest{
-		SystemInstruction:  a.systemInstruction,
+		SystemInstruction:  a.turnInstruction(ctx),
 		History:            history,
-		Tools:              a.functionsMap,
+		Tools:              a.functions(),
 		HandleFunctionCall: a.handleFunctionCall,
 		Prompt:             prompt,
 	}
 
 	newContents, err := a.provider.Send(ctx, req)
 	if err != nil {
+		if ctx.Err() != nil {
+			a.savePartial(ctx, sessionID, history, prompt, "")
+		}
 		return nil, err
 	}
 
+	attachCitations(newContents, citations.list())
+
 	a.saveHistory(ctx, sessionID, append(history, newContents...))
 
 	// Return only model response parts (exclude the user message we added)
@@ -127,44 +380,144 @@ func (a *Agent) Send(ctx context.Context, sessionID string, prompt string) ([]mo
 	return modelContents, nil
 }
 
-func (a *Agent) SendStream(ctx context.Context, sessionID string, prompt string, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error) error {
+// SendStream runs a turn, streaming text and tool activity through the
+// callbacks. onCitations, if non-nil, receives the sources collected during the
+// turn once the model has finished answering.
+func (a *Agent) SendStream(ctx context.Context, sessionID string, prompt string, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error, onCitations func([]model.Citation) error) error {
+	ctx, done := a.startTurn(ctx, sessionID)
+	defer done()
 	ctx = WithSessionID(ctx, sessionID)
+	ctx, citations := withCitationCollector(ctx)
 
-	history, err := a.loadHistory(ctx, sessionID)
+	if err := a.ClaimSession(ctx, sessionID); err != nil {
+		return err
+	}
+	history, err := a.turnHistory(ctx, sessionID)
 	if err != nil {
 		return err
 	}
 
 	req := ProviderRequest{
-		SystemInstruction:  a.systemInstruction,
+		SystemInstruction:  a.turnInstruction(ctx),
 		History:            history,
-		Tools:              a.functionsMap,
+		Tools:              a.functions(),
 		HandleFunctionCall: a.handleFunctionCall,
 		Prompt:             prompt,
 	}
 
-	newContents, err := a.provider.SendStream(ctx, req, onText, onFunctionCall, onTurnDone)
+	// partial keeps the text streamed so far, so a cancelled turn can still
+	// be saved.
+	var partial strings.Builder
+	streamText := func(text string) error {
+		partial.WriteString(text)
+		if onText == nil {
+			return nil
+		}
+		return onText(text)
+	}
+
+	newContents, err := a.provider.SendStream(ctx, req, streamText, onFunctionCall, onTurnDone)
 	if err != nil {
+		if ctx.Err() != nil {
+			a.savePartial(ctx, sessionID, history, prompt, partial.String())
+		}
 		return err
 	}
 
+	cited := citations.list()
+	attachCitations(newContents, cited)
+	if onCitations != nil && len(cited) > 0 {
+		if err := onCitations(cited); err != nil {
+			return err
+		}
+	}
+
 	a.saveHistory(ctx, sessionID, append(history, newContents...))
 
 	return nil
 }
 
-func (a *Agent) ClearSession(ctx context.Context, sessionID string) {
+// SendMessages runs a turn on a conversation held by the caller rather than
+// in a session, as for stateless API clients: history precedes prompt, and
+// the system instruction includes the text added with WithTurnInstruction.
+// Nothing is saved. The turn streams when onText is non-nil, and onFunctionCall,
+// if also non-nil, is told of each tool the model calls. It returns the
+// model's contents.
+func (a *Agent) SendMessages(ctx context.Context, history []model.Content, prompt string, onText func(string) error, onFunctionCall func(name string, args map[string]any) error) ([]model.Content, error) {
+	ctx, citations := withCitationCollector(ctx)
+
+	req := ProviderRequest{
+		SystemInstruction:  a.turnInstruction(ctx),
+		History:            history,
+		Tools:              a.functions(),
+		HandleFunctionCall: a.handleFunctionCall,
+		Prompt:             prompt,
+	}
+
+	var (
+		newContents []model.Content
+		err         error
+	)
+	if onText == nil {
+		newContents, err = a.provider.Send(ctx, req)
+	} else {
+		newContents, err = a.provider.SendStream(ctx, req, onText, onFunctionCall, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attachCitations(newContents, citations.list())
+	return filterModelContents(newContents), nil
+}
+
+// ClaimSession binds sessionID to the principal on ctx, so that other
+// principals get ErrSessionForbidden. Without a principal, as when
+// authentication is disabled, sessions are not bound.
+func (a *Agent) ClaimSession(ctx context.Context, sessionID string) error {
+	p, ok := auth.PrincipalFromContext(ctx)
+	if !ok || a.sessionRepository == nil {
+		return nil
+	}
+	return a.sessionRepository.Claim(ctx, sessionID, p.Subject)
+}
+
+// AuthorizeSession returns ErrSessionForbidden if sessionID is bound to a
+// principal other than the one on ctx.
+func (a *Agent) AuthorizeSession(ctx context.Context, sessionID string) error {
+	p, ok := auth.PrincipalFromContext(ctx)
+	if !ok || a.sessionRepository == nil {
+		return nil
+	}
+	owner, err := a.sessionRepository.Owner(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != p.Subject {
+		return fmt.Errorf("session %q: %w", sessionID, ErrSessionForbidden)
+	}
+	return nil
+}
+
+func (a *Agent) ClearSession(ctx context.Context, sessionID string) error {
+	if err := a.AuthorizeSession(ctx, sessionID); err != nil {
+		return err
+	}
 	if a.sessionRepository != nil {
 		if err := a.sessionRepository.Delete(ctx, sessionID); err != nil {
-			fmt.Printf("agent: warning: failed to delete session %q: %v\n", sessionID, err)
+			log.Printf("agent: warning: failed to delete session %q: %v", sessionID, err)
 		}
 	}
+	return nil
 }
 
 func (a *Agent) GetSession(ctx context.Context, sessionID string) ([]model.Content, error) {
 	if a.sessionRepository == nil {
 		return []model.Content{}, nil
 	}
+	if err := a.AuthorizeSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
 
 	stored, err := a.sessionRepository.Load(ctx, sessionID)
 	if err != nil {
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/model"
+)
+
+// recordingProvider answers every turn with reply and keeps the requests.
+type recordingProvider struct {
+	reply string
+	reqs  []ProviderRequest
+}
+
+func (p *recordingProvider) Send(ctx context.Context, req ProviderRequest) ([]model.Content, error) {
+	p.reqs = append(p.reqs, req)
+	return []model.Content{
+		{Role: "user", Parts: []model.Part{{Text: req.Prompt}}},
+		{Role: "model", Parts: []model.Part{{Text: p.reply}}},
+	}, nil
+}
+
+func (p *recordingProvider) SendStream(ctx context.Context, req ProviderRequest, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error) ([]model.Content, error) {
+	if err := onText(p.reply); err != nil {
+		return nil, err
+	}
+	return p.Send(ctx, req)
+}
+
+func TestSendMessagesTurnInstruction(t *testing.T) {
+	p := &recordingProvider{reply: "Hi."}
+	a := New(p, "You are helpful.")
+
+	history := []model.Content{{Role: "user", Parts: []model.Part{{Text: "Earlier."}}}}
+	ctx := WithTurnInstruction(context.Background(), "Answer in French.")
+	contents, err := a.SendMessages(ctx, history, "Hello", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 1 || contents[0].Role != "model" {
+		t.Errorf("contents = %+v, want the model's answer only", contents)
+	}
+
+	if _, err := a.SendMessages(context.Background(), nil, "Hello", func(string) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"You are helpful.\n\nAnswer in French.", "You are helpful."}
+	for i, req := range p.reqs {
+		if req.SystemInstruction != want[i] {
+			t.Errorf("turn %d: system instruction = %q, want %q", i, req.SystemInstruction, want[i])
+		}
+	}
+	if len(p.reqs[0].History) != 1 || p.reqs[0].Prompt != "Hello" {
+		t.Errorf("request = %+v, want the history and prompt", p.reqs[0])
+	}
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/m2tx/agent_example/internal/model"
+)
+
+// citationCollector accumulates the sources returned by tools during a turn.
+type citationCollector struct {
+	mu        sync.Mutex
+	citations []model.Citation
+	index     map[string]int
+}
+
+func withCitationCollector(ctx context.Context) (context.Context, *citationCollector) {
+	c := &citationCollector{index: make(map[string]int)}
+	return context.WithValue(ctx, citationsKey, c), c
+}
+
+// RecordCitations registers sources used during the current turn and returns
+// the footnote number assigned to each, in order. A source already recorded
+// in the turn keeps its original number. Returns nil when ctx was not created
+// by Agent.Send or Agent.SendStream.
+func RecordCitations(ctx context.Context, citations ...model.Citation) []int {
+	c, ok := ctx.Value(citationsKey).(*citationCollector)
+	if !ok {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	numbers := make([]int, len(citations))
+	for i, cit := range citations {
+		key := cit.DocumentID + "\x00" + cit.Location
+		n, seen := c.index[key]
+		if !seen {
+			n = len(c.citations) + 1
+			cit.Index = n
+			c.citations = append(c.citations, cit)
+			c.index[key] = n
+		}
+		numbers[i] = n
+	}
+	return numbers
+}
+
+func (c *citationCollector) list() []model.Citation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]model.Citation(nil), c.citations...)
+}
+
+// attachCitations stores citations on the last model content of a turn so
+// they are persisted with the answer they support.
+func attachCitations(contents []model.Content, citations []model.Citation) {
+	if len(citations) == 0 {
+		return
+	}
+	for i := len(contents) - 1; i >= 0; i-- {
+		if contents[i].Role == "model" {
+			contents[i].Citations = citations
+			return
+		}
+	}
+}
@@ -2,92 +2,193 @@ package agent
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"log"
 	"math"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/ledongthuc/pdf"
+	"github.com/m2tx/agent_example/internal/vectorstore"
 )
 
 const embeddingDim = 512
 const defaultChunkSize = 800
 
 // EmbeddedDocument is a text chunk paired with its embedding vector.
-type EmbeddedDocument struct {
-	Filename  string
-	Text      string
-	Embedding []float32
-}
+type EmbeddedDocument = vectorstore.Document
 
-// Embedder indexes documents and provides semantic search via local hash embeddings.
+// Embedder chunks and embeds documents via local hash embeddings and provides
+// semantic search over the chunks held in its VectorStore.
 type Embedder struct {
-	docs []EmbeddedDocument
+	store vectorstore.VectorStore
 }
 
-// NewEmbedder creates a new Embedder.
+// NewEmbedder creates a new Embedder backed by an in-memory vector store.
 func NewEmbedder() *Embedder {
-	return &Embedder{}
+	return NewEmbedderWithStore(vectorstore.NewMemoryVectorStore())
+}
+
+// NewEmbedderWithStore creates a new Embedder backed by the given vector store.
+func NewEmbedderWithStore(store vectorstore.VectorStore) *Embedder {
+	return &Embedder{store: store}
 }
 
+// ErrUnsupportedDocument is returned when a document's extension is not one of
+// SupportedDocumentExtensions.
+var ErrUnsupportedDocument = errors.New("unsupported document type")
+
+// ErrEmptyDocument is returned when no text could be extracted from a document.
+var ErrEmptyDocument = errors.New("document contains no text")
+
+// SupportedDocumentExtensions lists the file extensions the embedder can read.
+var SupportedDocumentExtensions = []string{".txt", ".md", ".pdf"}
+
 // Index loads and embeds all .txt, .md, and .pdf files from dir.
 // Returns without error if the directory is empty or does not exist.
-func (e *Embedder) Index(dir string) error {
-	chunks, err := loadChunks(dir)
+func (e *Embedder) Index(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		entries, err = nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("embedder: load chunks: %w", err)
+		return fmt.Errorf("embedder: read dir: %w", err)
 	}
 
-	if len(chunks) == 0 {
-		log.Printf("embedder: no documents found in %q — search will return no results", dir)
-		return nil
+	var documents, chunks int
+	for _, entry := range entries {
+		if entry.IsDir() || !slices.Contains(SupportedDocumentExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("embedder: %w", err)
+		}
+
+		info, err := e.AddDocument(ctx, entry.Name(), data, map[string]any{"source": dir})
+		if errors.Is(err, ErrEmptyDocument) {
+			log.Printf("embedder: skipping %q: %v", entry.Name(), err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		documents++
+		chunks += info.Chunks
 	}
 
-	for _, c := range chunks {
-		e.docs = append(e.docs, EmbeddedDocument{
-			Filename:  c.filename,
-			Text:      c.text,
-			Embedding: embed(c.text),
-		})
+	if documents == 0 {
+		log.Printf("embedder: no documents found in %q — search will return no results", dir)
+		return nil
 	}
 
-	log.Printf("embedder: indexed %d chunks from %q", len(e.docs), dir)
+	log.Printf("embedder: indexed %d chunks from %d documents in %q", chunks, documents, dir)
 	return nil
 }
 
-// Search returns the topK most relevant chunks for the given query.
-func (e *Embedder) Search(query string, topK int) ([]EmbeddedDocument, error) {
-	if len(e.docs) == 0 {
-		return nil, nil
+// AddDocument extracts the text of a .txt, .md or .pdf file, splits it into
+// chunks and stores them. The document ID is derived from the filename alone,
+// so adding the same file again, whether ingested from a directory or
+// uploaded, replaces its chunks instead of duplicating them, and is a no-op
+// when its content did not change. The metadata is attached to every chunk
+// alongside the document size, content hash and creation time.
+func (e *Embedder) AddDocument(ctx context.Context, filename string, data []byte, metadata map[string]any) (vectorstore.DocumentInfo, error) {
+	documentID := documentID(filename)
+	sum := sha256.Sum256(data)
+	contentHash := hex.EncodeToString(sum[:])
+
+	existing, err := e.store.Get(ctx, documentID)
+	if err != nil {
+		return vectorstore.DocumentInfo{}, fmt.Errorf("embedder: get %q: %w", filename, err)
+	}
+	if len(existing) > 0 && existing[0].Metadata["sha256"] == contentHash {
+		return vectorstore.DocumentInfo{
+			ID:       documentID,
+			Filename: filename,
+			Chunks:   len(existing),
+			Metadata: existing[0].Metadata,
+		}, nil
 	}
 
-	queryVec := embed(query)
-
-	type scored struct {
-		doc   EmbeddedDocument
-		score float32
+	text, err := extractText(filename, data)
+	if err != nil {
+		return vectorstore.DocumentInfo{}, fmt.Errorf("embedder: %q: %w", filename, err)
 	}
 
-	results := make([]scored, 0, len(e.docs))
-	for _, doc := range e.docs {
-		results = append(results, scored{doc: doc, score: cosineSimilarity(queryVec, doc.Embedding)})
+	meta := map[string]any{
+		"size":       len(data),
+		"sha256":     contentHash,
+		"created_at": time.Now().UTC(),
+	}
+	for k, v := range metadata {
+		meta[k] = v
 	}
 
-	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+	var docs []EmbeddedDocument
+	for i, c := range splitChunks(text, defaultChunkSize) {
+		docs = append(docs, EmbeddedDocument{
+			DocumentID: documentID,
+			Filename:   filename,
+			Chunk:      i,
+			Text:       c,
+			Embedding:  embed(c),
+			Metadata:   meta,
+		})
+	}
 
-	if topK > len(results) {
-		topK = len(results)
+	if len(docs) == 0 {
+		return vectorstore.DocumentInfo{}, fmt.Errorf("embedder: %q: %w", filename, ErrEmptyDocument)
 	}
 
-	out := make([]EmbeddedDocument, topK)
-	for i := range out {
-		out[i] = results[i].doc
+	if len(existing) > 0 {
+		if err := e.store.Delete(ctx, documentID); err != nil {
+			return vectorstore.DocumentInfo{}, fmt.Errorf("embedder: replace %q: %w", filename, err)
+		}
 	}
-	return out, nil
+	if err := e.store.Add(ctx, docs...); err != nil {
+		return vectorstore.DocumentInfo{}, fmt.Errorf("embedder: store chunks: %w", err)
+	}
+
+	return vectorstore.DocumentInfo{
+		ID:       documentID,
+		Filename: filename,
+		Chunks:   len(docs),
+		Metadata: meta,
+	}, nil
+}
+
+// Documents lists the source documents held in the vector store.
+func (e *Embedder) Documents(ctx context.Context) ([]vectorstore.DocumentInfo, error) {
+	return e.store.List(ctx)
+}
+
+// Document returns the chunks of a single document, or nil if it does not exist.
+func (e *Embedder) Document(ctx context.Context, documentID string) ([]EmbeddedDocument, error) {
+	return e.store.Get(ctx, documentID)
+}
+
+// DeleteDocument removes every chunk of a document from the vector store.
+func (e *Embedder) DeleteDocument(ctx context.Context, documentID string) error {
+	return e.store.Delete(ctx, documentID)
+}
+
+// Len returns the number of indexed chunks.
+func (e *Embedder) Len(ctx context.Context) (int, error) {
+	return e.store.Count(ctx)
+}
+
+// Search returns the topK most relevant chunks for the given query.
+func (e *Embedder) Search(ctx context.Context, query string, topK int) ([]EmbeddedDocument, error) {
+	return e.store.Search(ctx, embed(query), topK)
 }
 
 // embed converts text into a fixed-size vector using feature hashing (no external model).
@@ -112,52 +213,26 @@ func embed(text string) []float32 {
 
 // ---- internal chunk helpers ----
 
-type chunk struct {
-	filename string
-	text     string
+// documentID derives a document's ID from its base filename, so the same
+// file maps to the same ID whichever directory or upload it came from.
+func documentID(filename string) string {
+	sum := sha256.Sum256([]byte(filepath.Base(filename)))
+	return hex.EncodeToString(sum[:12])
 }
 
-func loadChunks(dir string) ([]chunk, error) {
-	entries, err := os.ReadDir(dir)
-	if os.IsNotExist(err) {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	var chunks []chunk
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		ext := strings.ToLower(filepath.Ext(name))
-
-		var text string
-		switch ext {
-		case ".txt", ".md":
-			data, err := os.ReadFile(filepath.Join(dir, name))
-			if err != nil {
-				return nil, err
-			}
-			text = string(data)
-		case ".pdf":
-			var err error
-			text, err = readPDF(filepath.Join(dir, name))
-			if err != nil {
-				return nil, fmt.Errorf("read pdf %q: %w", name, err)
-			}
-		default:
-			continue
-		}
-
-		for _, c := range splitChunks(text, defaultChunkSize) {
-			chunks = append(chunks, chunk{filename: name, text: c})
+func extractText(filename string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt", ".md":
+		return string(data), nil
+	case ".pdf":
+		text, err := readPDF(data)
+		if err != nil {
+			return "", fmt.Errorf("read pdf: %w", err)
 		}
+		return text, nil
+	default:
+		return "", ErrUnsupportedDocument
 	}
-
-	return chunks, nil
 }
 
 func splitChunks(text string, maxLen int) []string {
@@ -190,12 +265,11 @@ func splitChunks(text string, maxLen int) []string {
 	return chunks
 }
 
-func readPDF(path string) (string, error) {
-	f, r, err := pdf.Open(path)
+func readPDF(data []byte) (string, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
 
 	plain, err := r.GetPlainText()
 	if err != nil {
@@ -208,20 +282,3 @@ func readPDF(path string) (string, error) {
 	}
 	return buf.String(), nil
 }
-
-func cosineSimilarity(a, b []float32) float32 {
-	if len(a) != len(b) {
-		return 0
-	}
-	var dot, normA, normB float64
-	for i := range a {
-		dot += float64(a[i]) * float64(b[i])
-		normA += float64(a[i]) * float64(a[i])
-		normB += float64(b[i]) * float64(b[i])
-	}
-	denom := math.Sqrt(normA) * math.Sqrt(normB)
-	if denom == 0 {
-		return 0
-	}
-	return float32(dot / denom)
-}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddDocumentSameIDAcrossSources(t *testing.T) {
+	ctx := context.Background()
+	e := NewEmbedder()
+
+	dir := t.TempDir()
+	data := []byte("Vacation requests go through the HR portal.")
+	if err := os.WriteFile(filepath.Join(dir, "vacation.md"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same directory reached through two different paths.
+	if err := e.Index(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Index(ctx, filepath.Join(dir, "..", filepath.Base(dir))); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := []byte("Vacation requests now go through the new HR portal.")
+	info, err := e.AddDocument(ctx, "vacation.md", updated, map[string]any{"source": "upload"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := documentID("vacation.md"); info.ID != want {
+		t.Errorf("ID = %q, want %q", info.ID, want)
+	}
+
+	docs, err := e.store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("got %d documents, want 1: %+v", len(docs), docs)
+	}
+	if docs[0].Metadata["source"] != "upload" {
+		t.Errorf("source = %v, want the upload to replace the indexed file", docs[0].Metadata["source"])
+	}
+}
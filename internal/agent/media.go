@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/m2tx/agent_example/internal/model"
+)
+
+// FunctionResult is the outcome of a function call as handed to the
+// provider: the JSON response plus any media the function attached.
+type FunctionResult struct {
+	Response map[string]any
+	Parts    []model.Part
+}
+
+// partCollector accumulates the media attached by a single function call.
+type partCollector struct {
+	mu    sync.Mutex
+	parts []model.Part
+}
+
+func withPartCollector(ctx context.Context) (context.Context, *partCollector) {
+	c := &partCollector{}
+	return context.WithValue(ctx, partsKey, c), c
+}
+
+// AttachParts adds media parts, such as images or audio returned by a tool,
+// to the response of the function call running in ctx so that the provider
+// forwards them to the model. It reports false when ctx does not belong to a
+// function call made by the agent.
+func AttachParts(ctx context.Context, parts ...model.Part) bool {
+	c, ok := ctx.Value(partsKey).(*partCollector)
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.parts = append(c.parts, parts...)
+	return true
+}
+
+func (c *partCollector) list() []model.Part {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]model.Part(nil), c.parts...)
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// ToolCall is a function call made by the model during a turn.
+type ToolCall struct {
+	// ID identifies the call within the server's lifetime.
+	ID   string
+	Name string
+	Args map[string]any
+}
+
+// ToolResult is the outcome of a ToolCall.
+type ToolResult struct {
+	ID       string
+	Name     string
+	Response map[string]any
+	Err      error
+	Duration time.Duration
+}
+
+// ToolObserver is told about the function calls of the turns running in a
+// context, before each call starts and after it returns. Calls may run
+// concurrently with the turn's other callbacks.
+type ToolObserver struct {
+	OnCall   func(ToolCall)
+	OnResult func(ToolResult)
+}
+
+type toolCallIDKey struct{}
+
+// WithToolObserver returns a context whose function calls are reported to o.
+func WithToolObserver(ctx context.Context, o ToolObserver) context.Context {
+	return context.WithValue(ctx, toolObserverKey, o)
+}
+
+// ToolCallIDFromContext returns the ID of the function call running in ctx.
+func ToolCallIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(toolCallIDKey{}).(string)
+	return id, ok
+}
+
+func newToolCallID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
@@ -11,8 +11,12 @@ type ProviderRequest struct {
 	SystemInstruction  string
 	History            []model.Content
 	Tools              map[string]*FunctionDeclaration
-	HandleFunctionCall func(ctx context.Context, name string, args map[string]any) (map[string]any, error)
+	HandleFunctionCall func(ctx context.Context, name string, args map[string]any) (FunctionResult, error)
 	Prompt             string
+
+	// Model and MaxTokens override the provider defaults when set.
+	Model     string
+	MaxTokens int
 }
 
 // LLMProvider abstracts a backend LLM (Gemini, Anthropic, etc.).
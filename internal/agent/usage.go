@@ -0,0 +1,38 @@
+package agent
+
+import "context"
+
+// Usage is the number of tokens consumed by one model call.
+type Usage struct {
+	// Model is the model that served the call, as reported by the provider.
+	Model        string `json:"model"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+// Total returns the input and output tokens of u.
+func (u Usage) Total() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// WithUsageRecorder returns a context whose model calls report their token
+// usage to record. Recorders installed by outer contexts are called too.
+func WithUsageRecorder(ctx context.Context, record func(ctx context.Context, u Usage)) context.Context {
+	parent, _ := ctx.Value(usageKey).(func(context.Context, Usage))
+	if parent == nil {
+		return context.WithValue(ctx, usageKey, record)
+	}
+	return context.WithValue(ctx, usageKey, func(ctx context.Context, u Usage) {
+		record(ctx, u)
+		parent(ctx, u)
+	})
+}
+
+// RecordUsage reports the usage of a model call. Providers call it after
+// every response, so a turn with tool calls reports several times. It does
+// nothing when ctx carries no recorder.
+func RecordUsage(ctx context.Context, u Usage) {
+	if record, ok := ctx.Value(usageKey).(func(context.Context, Usage)); ok {
+		record(ctx, u)
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys(" alice=k1, ,bob=k=2,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []APIKey{{Key: "k1", Subject: "alice"}, {Key: "k=2", Subject: "bob"}}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("ParseAPIKeys = %+v, want %+v", keys, want)
+	}
+
+	if _, err := ParseAPIKeys("alice"); err == nil {
+		t.Error("ParseAPIKeys accepted an entry without a key")
+	}
+	if keys, err := ParseAPIKeys(""); err != nil || len(keys) != 0 {
+		t.Errorf(`ParseAPIKeys("") = %+v, %v; want none`, keys, err)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	t.Setenv("TEST_HR_KEY", "secret-hr")
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := `[{"key": "${TEST_HR_KEY}", "subject": "hr-portal", "tenant": "hr"}, {"key": "plain", "subject": "ops", "name": "Ops"}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Key != "secret-hr" || keys[0].Tenant != "hr" || keys[1].Name != "Ops" {
+		t.Errorf("LoadAPIKeys = %+v", keys)
+	}
+
+	if _, err := LoadAPIKeys(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadAPIKeys read a missing file")
+	}
+}
+
+func TestNewAPIKeys(t *testing.T) {
+	for _, k := range []APIKey{{Subject: "alice"}, {Key: "k1"}} {
+		if _, err := NewAPIKeys(k); err == nil {
+			t.Errorf("NewAPIKeys accepted %+v", k)
+		}
+	}
+}
+
+func TestAPIKeysAuthenticate(t *testing.T) {
+	a, err := NewAPIKeys(
+		APIKey{Key: "k1", Subject: "alice", Name: "Alice"},
+		APIKey{Key: "k2", Subject: "hr-portal", Tenant: "hr"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		subject string
+		tenant  string
+		err     error
+	}{
+		{name: "X-API-Key", header: "X-API-Key", value: "k1", subject: "alice"},
+		{name: "bearer", header: "Authorization", value: "Bearer k2", subject: "hr-portal", tenant: "hr"},
+		{name: "lowercase scheme", header: "Authorization", value: "bearer k1", subject: "alice"},
+		{name: "unknown key", header: "X-API-Key", value: "nope", err: ErrInvalidCredentials},
+		{name: "unknown bearer", header: "Authorization", value: "Bearer nope", err: ErrInvalidCredentials},
+		{name: "no credentials", err: ErrNoCredentials},
+		{name: "basic auth", header: "Authorization", value: "Basic azE6", err: ErrNoCredentials},
+		{name: "JWT is left to the JWT authenticator", header: "Authorization", value: "Bearer a.b.c", err: ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			p, err := a.Authenticate(r)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Authenticate error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Subject != tt.subject || p.Tenant != tt.tenant || p.Method != MethodAPIKey {
+				t.Errorf("principal = %+v, want subject %q, tenant %q", p, tt.subject, tt.tenant)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	keys, err := NewAPIKeys(APIKey{Key: "k1", Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := NewTrustedHeader("X-Forwarded-User", "", []string{"192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := Chain{keys, header}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-User", "bob")
+	if p, err := chain.Authenticate(r); err != nil || p.Subject != "bob" {
+		t.Errorf("Authenticate without a key = %+v, %v; want bob from the header", p, err)
+	}
+
+	// An invalid key is not passed on to the next authenticator.
+	r.Header.Set("X-API-Key", "nope")
+	if _, err := chain.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate with an invalid key = %v, want ErrInvalidCredentials", err)
+	}
+
+	if _, err := chain.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Authenticate without credentials = %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	keys, err := NewAPIKeys(APIKey{Key: "k1", Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Middleware(keys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := PrincipalFromContext(r.Context()); ok {
+			w.Write([]byte(p.Subject))
+		}
+	}), "/healthz")
+
+	for _, tt := range []struct {
+		path, key string
+		status    int
+		body      string
+	}{
+		{"/prompt", "k1", http.StatusOK, "alice"},
+		{"/prompt", "", http.StatusUnauthorized, ""},
+		{"/prompt", "nope", http.StatusUnauthorized, ""},
+		{"/healthz", "", http.StatusOK, ""},
+		{"/healthz/x", "", http.StatusUnauthorized, ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.key != "" {
+			r.Header.Set("X-API-Key", tt.key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status || (tt.status == http.StatusOK && w.Body.String() != tt.body) {
+			t.Errorf("%s with key %q = %d %q, want %d %q", tt.path, tt.key, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+		if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 without WWW-Authenticate", tt.path)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package auth authenticates API requests and carries the caller's identity
+// on the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request does
+	// not carry the kind of credentials it checks, so the next one may try.
+	ErrNoCredentials = errors.New("auth: no credentials")
+
+	// ErrInvalidCredentials is returned for credentials that are present but
+	// wrong, expired or otherwise rejected.
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+)
+
+// Method names how a Principal was authenticated.
+type Method string
+
+const (
+	MethodAPIKey        Method = "apikey"
+	MethodJWT           Method = "jwt"
+	MethodTrustedHeader Method = "header"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Subject uniquely identifies the caller; sessions are bound to it.
+	Subject string         `json:"subject"`
+	Name    string         `json:"name,omitempty"`
+	Method  Method         `json:"method"`
+	Claims  map[string]any `json:"claims,omitempty"`
+
+	// Tenant is the tenant the credentials belong to, if they are bound to
+	// one.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Expiry is when the credentials stop being valid, if they expire.
+	Expiry time.Time `json:"expiry,omitzero"`
+
+	// Token is the bearer token the caller presented, for JWTs only, so it
+	// can be forwarded to services that trust the same issuer.
+	Token string `json:"-"`
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the caller stored by WithPrincipal. Tools
+// receive it on the context of their calls.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each authenticator in order until one finds credentials. The
+// first authenticator that finds credentials decides: invalid credentials
+// are not passed on to the next one.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// Middleware rejects requests that authn cannot authenticate with 401 and
+// puts the Principal of the others on their context. Requests for the
+// public paths, matched exactly, are let through unauthenticated.
+func Middleware(authn Authenticator, next http.Handler, public ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(public, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := authn.Authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) && !errors.Is(err, ErrInvalidCredentials) {
+				log.Printf("auth: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="agent_example"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
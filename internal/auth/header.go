@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TrustedHeader authenticates requests by a header set by an authenticating
+// reverse proxy, such as X-Forwarded-User. The header is only believed from
+// the proxies' addresses, since any client could send it.
+type TrustedHeader struct {
+	header     string
+	nameHeader string
+	proxies    Proxies
+}
+
+// NewTrustedHeader creates an authenticator reading the caller from header
+// and, if nameHeader is set, their display name from nameHeader. proxies
+// lists the addresses or CIDR ranges allowed to set them; at least one is
+// required, since any client could otherwise claim to be any user.
+func NewTrustedHeader(header, nameHeader string, proxies []string) (*TrustedHeader, error) {
+	if header == "" {
+		return nil, fmt.Errorf("auth: trusted header: a header name is required")
+	}
+
+	parsed, err := ParseProxies(proxies)
+	if err != nil {
+		return nil, err
+	}
+	h := &TrustedHeader{header: header, nameHeader: nameHeader, proxies: parsed}
+	if len(h.proxies) == 0 {
+		return nil, fmt.Errorf("auth: trusted header %s: at least one trusted proxy is required", header)
+	}
+	return h, nil
+}
+
+func (h *TrustedHeader) Authenticate(r *http.Request) (*Principal, error) {
+	subject := strings.TrimSpace(r.Header.Get(h.header))
+	if subject == "" {
+		return nil, ErrNoCredentials
+	}
+	if !h.proxies.Trusted(r.RemoteAddr) {
+		return nil, fmt.Errorf("%w: %s from untrusted peer %s", ErrInvalidCredentials, h.header, r.RemoteAddr)
+	}
+
+	p := &Principal{Subject: subject, Method: MethodTrustedHeader}
+	if h.nameHeader != "" {
+		p.Name = r.Header.Get(h.nameHeader)
+	}
+	return p, nil
+}
@@ -0,0 +1,356 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksMaxAge is how long keys fetched from a JWKS URL are used before
+	// being fetched again.
+	jwksMaxAge = time.Hour
+
+	// jwksMinRefresh limits refetches triggered by tokens signed with an
+	// unknown key, and is the first delay before retrying a failed fetch.
+	jwksMinRefresh = time.Minute
+
+	// jwksMaxBackoff caps the delay between retries of a failing fetch.
+	jwksMaxBackoff = 15 * time.Minute
+
+	defaultLeeway = time.Minute
+)
+
+// JWTConfig configures JWT validation.
+type JWTConfig struct {
+	// JWKS is the URL or file path of the JSON Web Key Set holding the
+	// issuer's public keys.
+	JWKS string
+
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+
+	// SubjectClaim names the claim identifying the caller; "sub" by default.
+	SubjectClaim string
+
+	// TenantClaim, if set, names the claim binding the caller to a tenant.
+	TenantClaim string
+
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+// validMethods are the signature algorithms accepted. HMAC is left out, so
+// a public key can never be used as a shared secret, and so is "none".
+var validMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// JWT authenticates requests carrying a signed JWT as a bearer token.
+// RSA (RS*, PS*), ECDSA (ES*) and Ed25519 (EdDSA) signatures are supported.
+type JWT struct {
+	cfg    JWTConfig
+	client *http.Client
+	parser *jwt.Parser
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+
+	// retryAt delays the next fetch while one is running or after one
+	// failed; failures counts the failed fetches in a row.
+	retryAt  time.Time
+	failures int
+}
+
+// NewJWT creates a JWT authenticator and loads its key set.
+func NewJWT(ctx context.Context, cfg JWTConfig) (*JWT, error) {
+	if cfg.JWKS == "" {
+		return nil, errors.New("auth: jwt: a JWKS URL or file is required")
+	}
+	if cfg.SubjectClaim == "" {
+		cfg.SubjectClaim = "sub"
+	}
+	if cfg.Leeway == 0 {
+		cfg.Leeway = defaultLeeway
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(validMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	j := &JWT{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}, parser: jwt.NewParser(opts...)}
+	if err := j.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := j.verify(r.Context(), token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	subject, _ := claims[j.cfg.SubjectClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidCredentials, j.cfg.SubjectClaim)
+	}
+	p := &Principal{Subject: subject, Method: MethodJWT, Claims: claims, Token: token}
+	for _, claim := range []string{"name", "preferred_username", "email"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			p.Name = name
+			break
+		}
+	}
+	if j.cfg.TenantClaim != "" {
+		p.Tenant, _ = claims[j.cfg.TenantClaim].(string)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		p.Expiry = time.Unix(int64(exp), 0)
+	}
+	return p, nil
+}
+
+// verify checks the signature and the time, issuer and audience claims of
+// token and returns its claims.
+func (j *JWT) verify(ctx context.Context, token string) (map[string]any, error) {
+	claims := jwt.MapClaims{}
+	_, err := j.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := j.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		// Each ES algorithm is tied to one curve, so a token cannot pick
+		// a weaker check than its key was made for.
+		if m, ok := t.Method.(*jwt.SigningMethodECDSA); ok {
+			if k, ok := key.(*ecdsa.PublicKey); ok && k.Curve.Params().BitSize != m.CurveBits {
+				return nil, fmt.Errorf("algorithm %q not allowed for this key", t.Method.Alg())
+			}
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// key returns the verification key named kid. The key set is refetched
+// when it is older than jwksMaxAge, or once a minute at most if kid is
+// unknown since the issuer may have rotated its keys. When a fetch fails the
+// cached keys stay in use and fetches are retried with backoff. Without a
+// kid the set must hold a single key.
+func (j *JWT) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key, found := j.lookup(kid)
+	now := time.Now()
+	due := j.isURL() && !now.Before(j.retryAt) &&
+		(now.Sub(j.fetchedAt) > jwksMaxAge || (!found && now.Sub(j.fetchedAt) > jwksMinRefresh))
+	if due {
+		// Concurrent requests keep using the cached keys meanwhile.
+		j.retryAt = now.Add(jwksMinRefresh)
+	}
+	j.mu.Unlock()
+
+	if due {
+		if err := j.refresh(ctx); err != nil {
+			log.Printf("%v; using the cached keys", err)
+		} else {
+			j.mu.Lock()
+			key, found = j.lookup(kid)
+			j.mu.Unlock()
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (j *JWT) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+func (j *JWT) isURL() bool {
+	return strings.HasPrefix(j.cfg.JWKS, "https://") || strings.HasPrefix(j.cfg.JWKS, "http://")
+}
+
+// refresh loads the key set from the configured URL or file.
+func (j *JWT) refresh(ctx context.Context) error {
+	var (
+		data []byte
+		err  error
+	)
+	if j.isURL() {
+		data, err = j.fetch(ctx)
+	} else {
+		data, err = os.ReadFile(j.cfg.JWKS)
+	}
+	var keys map[string]crypto.PublicKey
+	if err != nil {
+		err = fmt.Errorf("auth: load jwks: %w", err)
+	} else if keys, err = parseJWKS(data); err != nil {
+		err = fmt.Errorf("auth: parse jwks %s: %w", j.cfg.JWKS, err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err != nil {
+		j.failures++
+		j.retryAt = time.Now().Add(min(jwksMinRefresh<<min(j.failures-1, 10), jwksMaxBackoff))
+		return err
+	}
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.retryAt = time.Time{}
+	j.failures = 0
+	return nil
+}
+
+func (j *JWT) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.cfg.JWKS, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", j.cfg.JWKS, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS decodes the signing keys of a JSON Web Key Set, keyed by kid.
+// Keys of unsupported types are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
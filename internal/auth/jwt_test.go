@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWK encodes the public half of key as a JWK.
+func testJWK(t *testing.T, kid string, key crypto.PublicKey) map[string]string {
+	t.Helper()
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return map[string]string{"kty": "EC", "kid": kid, "crv": k.Curve.Params().Name, "x": b64(k.X.FillBytes(make([]byte, size))), "y": b64(k.Y.FillBytes(make([]byte, size)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(k)}
+	}
+	t.Fatalf("unsupported key type %T", key)
+	return nil
+}
+
+func testJWKS(t *testing.T, keys map[string]crypto.PublicKey) []byte {
+	t.Helper()
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, testJWK(t, kid, key))
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "alice",
+		"iss": "https://issuer.example",
+		"aud": "agent",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func with(claims jwt.MapClaims, key string, value any) jwt.MapClaims {
+	c := jwt.MapClaims{}
+	for k, v := range claims {
+		c[k] = v
+	}
+	if value == nil {
+		delete(c, key)
+	} else {
+		c[key] = value
+	}
+	return c
+}
+
+func authenticate(j *JWT, token string) (*Principal, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return j.Authenticate(r)
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	jwks := testJWKS(t, map[string]crypto.PublicKey{
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+		"ed":  edPub,
+	})
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	j, err := NewJWT(context.Background(), JWTConfig{JWKS: path, Issuer: "https://issuer.example", Audience: "agent", Leeway: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	none := sign(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, validClaims())
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"RS256", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims()), true},
+		{"PS384", sign(t, jwt.SigningMethodPS384, "rsa", rsaKey, validClaims()), true},
+		{"ES256", sign(t, jwt.SigningMethodES256, "ec", ecKey, validClaims()), true},
+		{"EdDSA", sign(t, jwt.SigningMethodEdDSA, "ed", edKey, validClaims()), true},
+		{"audience in list", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(validClaims(), "aud", []string{"other", "agent"})), true},
+
+		{"alg none", none, false},
+		{"HS256 with the public key as secret", sign(t, jwt.SigningMethodHS256, "rsa", rsaPublicDER, validClaims()), false},
+		{"ES384 on a P-256 key", sign(t, jwt.SigningMethodES384, "ec", ec384Key, validClaims()), false},
+		{"RS256 on an EC key", sign(t, jwt.SigningMethodRS256, "ec", rsaKey, validClaims()), false},
+		{"EdDSA on an RSA key", sign(t, jwt.SigningMethodEdDSA, "rsa", edKey, validClaims()), false},
+		{"wrong key", sign(t, jwt.SigningMethodRS256, "rsa", otherKey, validClaims()), false},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "gone", rsaKey, validClaims()), false},
+		{"no kid with several keys", sign(t, jwt.SigningMethodRS256, "", rsaKey, validClaims()), false},
+		{"expired", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(validClaims(), "exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"missing exp", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(validClaims(), "exp", nil)), false},
+		{"not valid yet", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(validClaims(), "nbf", time.Now().Add(time.Minute).Unix())), false},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(validClaims(), "iss", "https://evil.example")), false},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(validClaims(), "aud", "other")), false},
+		{"missing subject", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(validClaims(), "sub", nil)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := authenticate(j, tt.token)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Authenticate: %v", err)
+				}
+				if p.Subject != "alice" || p.Method != MethodJWT {
+					t.Errorf("principal = %+v, want subject alice via jwt", p)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate error = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+// jwksServer serves a key set that tests can replace or make fail.
+type jwksServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	jwks  []byte
+	fail  bool
+	fetch atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, jwks []byte) *jwksServer {
+	s := &jwksServer{jwks: jwks}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetch.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(s.jwks)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(jwks []byte, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwks, s.fail = jwks, fail
+}
+
+// age makes the cached key set look fetched d ago.
+func (j *JWT) age(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetchedAt = time.Now().Add(-d)
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newJWKSServer(t, testJWKS(t, map[string]crypto.PublicKey{"k1": &oldKey.PublicKey}))
+	j, err := NewJWT(context.Background(), JWTConfig{JWKS: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.set(testJWKS(t, map[string]crypto.PublicKey{"k2": &newKey.PublicKey}), false)
+	rotated := sign(t, jwt.SigningMethodRS256, "k2", newKey, validClaims())
+
+	// A fetch happened less than jwksMinRefresh ago, so the unknown kid
+	// does not trigger another one yet.
+	if _, err := authenticate(j, rotated); err == nil {
+		t.Fatal("token signed with a key not fetched yet was accepted")
+	}
+	if n := srv.fetch.Load(); n != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", n)
+	}
+
+	j.age(2 * jwksMinRefresh)
+	if _, err := authenticate(j, rotated); err != nil {
+		t.Fatalf("token signed with the rotated key: %v", err)
+	}
+	if _, err := authenticate(j, sign(t, jwt.SigningMethodRS256, "k1", oldKey, validClaims())); err == nil {
+		t.Error("token signed with the retired key was accepted")
+	}
+}
+
+func TestJWTRefreshFailureKeepsCachedKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newJWKSServer(t, testJWKS(t, map[string]crypto.PublicKey{"k1": &key.PublicKey}))
+	j, err := NewJWT(context.Background(), JWTConfig{JWKS: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.set(nil, true)
+	j.age(2 * jwksMaxAge)
+	token := sign(t, jwt.SigningMethodRS256, "k1", key, validClaims())
+	for range 5 {
+		if _, err := authenticate(j, token); err != nil {
+			t.Fatalf("Authenticate during an IdP outage: %v", err)
+		}
+	}
+	// Only the first request tried to refresh; the others wait for the
+	// backoff.
+	if n := srv.fetch.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+
+	// Once the backoff expires and the IdP is back, the keys are refreshed.
+	srv.set(testJWKS(t, map[string]crypto.PublicKey{"k1": &key.PublicKey}), false)
+	j.mu.Lock()
+	j.retryAt = time.Time{}
+	j.mu.Unlock()
+	if _, err := authenticate(j, token); err != nil {
+		t.Fatal(err)
+	}
+	j.mu.Lock()
+	failures, fresh := j.failures, time.Since(j.fetchedAt) < time.Minute
+	j.mu.Unlock()
+	if failures != 0 || !fresh {
+		t.Errorf("after recovery failures = %d, fresh = %v; want 0, true", failures, fresh)
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Proxies lists the reverse proxies in front of the server, which are
+// trusted to report the client's address in X-Forwarded-For and, with
+// TrustedHeader, the caller's identity.
+type Proxies []netip.Prefix
+
+// ParseProxies parses addresses and CIDR ranges, skipping empty entries.
+func ParseProxies(list []string) (Proxies, error) {
+	var proxies Proxies
+	for _, p := range list {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, fmt.Errorf("auth: trusted proxy %q: %w", p, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("auth: trusted proxy %q: %w", p, err)
+		}
+		proxies = append(proxies, prefix)
+	}
+	return proxies, nil
+}
+
+// Trusted reports whether addr, with or without a port, is one of the
+// proxies.
+func (p Proxies) Trusted(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(host))
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientAddr returns the address of the client that sent r, without its
+// port. When r comes from a proxy, it is the last address in
+// X-Forwarded-For that is not a proxy: the addresses before it were
+// reported by the client itself and could be forged.
+func (p Proxies) ClientAddr(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if !p.Trusted(addr) {
+		return addr
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		addr = hop
+		if !p.Trusted(hop) {
+			break
+		}
+	}
+	return addr
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxiesClientAddr(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8", " 192.168.1.1 ", "", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"direct ignores forwarded", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"proxy", "10.1.2.3:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"proxy without forwarded", "10.1.2.3:443", nil, "10.1.2.3"},
+		{"forged entries are skipped", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "192.168.1.1:443", []string{"198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"several headers", "10.1.2.3:443", []string{"1.2.3.4", "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3:443", []string{"10.0.0.5, 10.0.0.2"}, "10.0.0.5"},
+		{"IPv6 proxy", "[fd00::1]:443", []string{"2001:db8::5"}, "2001:db8::5"},
+		{"IPv4-mapped proxy", "[::ffff:10.1.2.3]:443", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/prompt", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := proxies.ClientAddr(r); got != tt.want {
+				t.Errorf("ClientAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	if _, err := ParseProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParseProxies accepted an invalid prefix")
+	}
+	if _, err := ParseProxies([]string{"proxy.local"}); err == nil {
+		t.Error("ParseProxies accepted a host name")
+	}
+	if p, err := ParseProxies([]string{""}); err != nil || len(p) != 0 {
+		t.Errorf("ParseProxies(\"\") = %v, %v; want none", p, err)
+	}
+}
+
+func TestTrustedHeader(t *testing.T) {
+	if _, err := NewTrustedHeader("X-Forwarded-User", "", nil); err == nil {
+		t.Fatal("NewTrustedHeader accepted no trusted proxies")
+	}
+
+	h, err := NewTrustedHeader("X-Forwarded-User", "X-Forwarded-Name", []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if _, err := h.Authenticate(r); err != ErrNoCredentials {
+		t.Errorf("Authenticate without the header = %v, want ErrNoCredentials", err)
+	}
+
+	r.Header.Set("X-Forwarded-User", "alice")
+	r.Header.Set("X-Forwarded-Name", "Alice")
+	p, err := h.Authenticate(r)
+	if err != nil || p.Subject != "alice" || p.Name != "Alice" || p.Method != MethodTrustedHeader {
+		t.Errorf("Authenticate from the proxy = %+v, %v", p, err)
+	}
+
+	r.RemoteAddr = "203.0.113.7:1234"
+	if _, err := h.Authenticate(r); err == nil {
+		t.Error("Authenticate believed the header from an untrusted peer")
+	}
+}
@@ -3,8 +3,11 @@ package functions
 import (
 	"context"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
 )
 
 // CreateDocsSearchFunctionDeclaration returns an agent tool that semantically
@@ -39,6 +42,10 @@ func CreateDocsSearchFunctionDeclaration(e *agent.Embedder) *agent.FunctionDecla
 								"type":        "string",
 								"description": "Relevant text excerpt from the document",
 							},
+							"citation": map[string]any{
+								"type":        "integer",
+								"description": "Footnote number to cite this excerpt as, e.g. [1]",
+							},
 						},
 					},
 				},
@@ -50,20 +57,52 @@ func CreateDocsSearchFunctionDeclaration(e *agent.Embedder) *agent.FunctionDecla
 				return nil, fmt.Errorf("search_docs: query argument is required")
 			}
 
-			docs, err := e.Search(query, 3)
+			docs, err := e.Search(ctx, query, 3)
 			if err != nil {
 				return nil, fmt.Errorf("search_docs: %w", err)
 			}
 
+			citations := make([]model.Citation, len(docs))
+			for i, doc := range docs {
+				citations[i] = model.Citation{
+					DocumentID: doc.DocumentID,
+					Filename:   doc.Filename,
+					Location:   fmt.Sprintf("chunk %d", doc.Chunk+1),
+					Snippet:    snippet(doc.Text, 240),
+				}
+			}
+			numbers := agent.RecordCitations(ctx, citations...)
+
 			results := make([]map[string]any, 0, len(docs))
-			for _, doc := range docs {
-				results = append(results, map[string]any{
+			for i, doc := range docs {
+				result := map[string]any{
 					"filename": doc.Filename,
 					"content":  doc.Text,
-				})
+				}
+				if numbers != nil {
+					result["citation"] = numbers[i]
+				}
+				results = append(results, result)
 			}
 
 			return map[string]any{"results": results}, nil
 		},
 	}
 }
+
+// snippet shortens text to at most maxLen bytes on a word boundary, or on a
+// rune boundary when the first word is longer than maxLen.
+func snippet(text string, maxLen int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) <= maxLen {
+		return text
+	}
+	cut := strings.LastIndex(text[:maxLen], " ")
+	if cut <= 0 {
+		cut = maxLen
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	return text[:cut] + "…"
+}
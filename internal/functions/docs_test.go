@@ -0,0 +1,32 @@
+package functions
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		maxLen int
+		want   string
+	}{
+		{"short", "hello  world", 20, "hello world"},
+		{"word boundary", "hello brave new world", 14, "hello brave…"},
+		{"long word", "abcdefghij", 4, "abcd…"},
+		{"rune boundary", "ação", 2, "a…"},
+		{"multibyte runes", "ééééé", 5, "éé…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := snippet(tt.text, tt.maxLen)
+			if got != tt.want {
+				t.Errorf("snippet(%q, %d) = %q, want %q", tt.text, tt.maxLen, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("snippet(%q, %d) = %q is not valid UTF-8", tt.text, tt.maxLen, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package health runs the dependency checks behind the readiness endpoint.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultTimeout bounds a single check when the Checker has no timeout.
+const defaultTimeout = 5 * time.Second
+
+// Check probes a dependency and returns nil when it is usable.
+type Check func(ctx context.Context) error
+
+// State is the outcome of a check.
+type State string
+
+const (
+	StateUp   State = "up"
+	StateDown State = "down"
+)
+
+// Result is the outcome of one dependency check.
+type Result struct {
+	Name      string  `json:"name"`
+	State     State   `json:"state"`
+	Required  bool    `json:"required"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check. The service is ready when all
+// required checks are up; failing optional checks are only reported.
+type Report struct {
+	Ready  bool      `json:"ready"`
+	Checks []Result  `json:"checks"`
+	Time   time.Time `json:"time"`
+}
+
+type namedCheck struct {
+	name     string
+	required bool
+	check    Check
+}
+
+// Checker holds the checks of the service's dependencies.
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// NewChecker creates a Checker whose checks each get at most timeout to
+// answer.
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check. A failing required check makes the service not
+// ready.
+func (c *Checker) Add(name string, required bool, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, required: required, check: check})
+}
+
+// Run runs every check concurrently and reports their results in the order
+// they were added.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Go(func() { results[i] = c.run(ctx, nc) })
+	}
+	wg.Wait()
+
+	report := Report{Ready: true, Checks: results, Time: time.Now()}
+	for _, r := range results {
+		if r.Required && r.State != StateUp {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, nc namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := nc.check(ctx)
+
+	r := Result{
+		Name:      nc.name,
+		State:     StateUp,
+		Required:  nc.required,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		r.State = StateDown
+		r.Error = err.Error()
+	}
+	return r
+}
@@ -0,0 +1,383 @@
+package mcp
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	// discoveryTimeout bounds each metadata request made during discovery.
+	discoveryTimeout = 10 * time.Second
+
+	// authorizationTTL is how long an operator has to complete an
+	// authorization started with /mcp/oauth/{server}.
+	authorizationTTL = 10 * time.Minute
+
+	// maxPendingAuthorizations caps the authorizations started and not yet
+	// completed per server; starting another drops the oldest.
+	maxPendingAuthorizations = 16
+)
+
+var (
+	// ErrAuthorizationRequired is reported by servers using the
+	// authorization_code flow until an operator has authorized them.
+	ErrAuthorizationRequired = errors.New("mcp server authorization required")
+
+	// ErrUnknownAuthorization is returned by Manager.CompleteAuthorization
+	// for unknown or already used state values.
+	ErrUnknownAuthorization = errors.New("unknown authorization request")
+
+	// ErrUnknownServer is returned for server names that are not configured.
+	ErrUnknownServer = errors.New("unknown mcp server")
+)
+
+// oauthClient obtains and refreshes access tokens for one server. It is an
+// oauth2.TokenSource, so it plugs into oauth2.Transport.
+type oauthClient struct {
+	name     string
+	cfg      *AuthConfig
+	resource string
+
+	mu       sync.Mutex
+	endpoint *oauth2.Endpoint
+	source   oauth2.TokenSource
+	pending  map[string]pendingAuthorization // by state
+}
+
+// pendingAuthorization is an authorization code flow waiting for its
+// callback.
+type pendingAuthorization struct {
+	verifier string // PKCE
+	expires  time.Time
+}
+
+func newOAuthClient(cfg ServerConfig) *oauthClient {
+	if cfg.Auth == nil {
+		return nil
+	}
+	switch cfg.Auth.Type {
+	case AuthClientCredentials, AuthAuthorizationCode:
+		return &oauthClient{name: cfg.Name, cfg: cfg.Auth, resource: cfg.URL}
+	}
+	return nil
+}
+
+// Token implements oauth2.TokenSource.
+func (o *oauthClient) Token() (*oauth2.Token, error) {
+	source, err := o.tokenSource()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("mcp: server %q: token: %w", o.name, err)
+	}
+	return tok, nil
+}
+
+// tokenSource returns the source of the server's tokens, creating it for the
+// client_credentials flow on first use.
+func (o *oauthClient) tokenSource() (oauth2.TokenSource, error) {
+	o.mu.Lock()
+	source := o.source
+	o.mu.Unlock()
+	if source != nil {
+		return source, nil
+	}
+	if o.cfg.Type != AuthClientCredentials {
+		return nil, fmt.Errorf("server %q: %w", o.name, ErrAuthorizationRequired)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	endpoint, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &clientcredentials.Config{
+		ClientID:       o.cfg.ClientID,
+		ClientSecret:   o.cfg.ClientSecret,
+		TokenURL:       endpoint.TokenURL,
+		Scopes:         o.cfg.Scopes,
+		EndpointParams: url.Values{"resource": {o.resource}},
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.source == nil {
+		o.source = cc.TokenSource(context.Background())
+	}
+	return o.source, nil
+}
+
+// authorized reports whether the client can obtain tokens without user
+// interaction.
+func (o *oauthClient) authorized() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.cfg.Type == AuthClientCredentials || o.source != nil
+}
+
+// awaitingAuthorization reports whether the server cannot connect until an
+// operator authorizes it.
+func (c *Client) awaitingAuthorization() bool {
+	return c.oauth != nil && !c.oauth.authorized()
+}
+
+// authCodeURL starts the authorization code flow and returns the URL the
+// operator must visit, along with the state identifying the request.
+func (o *oauthClient) authCodeURL(ctx context.Context) (authURL, state string, err error) {
+	conf, err := o.config(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("mcp: oauth state: %w", err)
+	}
+	state = hex.EncodeToString(b)
+	verifier := oauth2.GenerateVerifier()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	o.dropExpired(now)
+	if len(o.pending) >= maxPendingAuthorizations {
+		var oldest string
+		for s, p := range o.pending {
+			if oldest == "" || p.expires.Before(o.pending[oldest].expires) {
+				oldest = s
+			}
+		}
+		delete(o.pending, oldest)
+	}
+	if o.pending == nil {
+		o.pending = make(map[string]pendingAuthorization)
+	}
+	o.pending[state] = pendingAuthorization{verifier: verifier, expires: now.Add(authorizationTTL)}
+
+	authURL = conf.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("resource", o.resource),
+	)
+	return authURL, state, nil
+}
+
+// exchange completes the flow started with state, keeping the resulting
+// token (and its refresh token) for later requests. Requests keep using the
+// current token until the new one is obtained.
+func (o *oauthClient) exchange(ctx context.Context, state, code string) error {
+	o.mu.Lock()
+	o.dropExpired(time.Now())
+	pending, ok := o.pending[state]
+	delete(o.pending, state)
+	o.mu.Unlock()
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+
+	conf, err := o.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	tok, err := conf.Exchange(ctx, code,
+		oauth2.VerifierOption(pending.verifier),
+		oauth2.SetAuthURLParam("resource", o.resource),
+	)
+	if err != nil {
+		return fmt.Errorf("mcp: server %q: exchange code: %w", o.name, err)
+	}
+
+	o.mu.Lock()
+	o.source = conf.TokenSource(context.Background(), tok)
+	o.mu.Unlock()
+	return nil
+}
+
+// dropExpired forgets the authorizations that can no longer be completed.
+// It must be called with mu held.
+func (o *oauthClient) dropExpired(now time.Time) {
+	for state, p := range o.pending {
+		if now.After(p.expires) {
+			delete(o.pending, state)
+		}
+	}
+}
+
+func (o *oauthClient) config(ctx context.Context) (*oauth2.Config, error) {
+	endpoint, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		Endpoint:     *endpoint,
+		RedirectURL:  o.cfg.RedirectURL,
+		Scopes:       o.cfg.Scopes,
+	}, nil
+}
+
+// discover resolves the authorization server endpoints, unless they are
+// configured: the server's protected resource metadata (RFC 9728) names the
+// authorization server, whose metadata (RFC 8414, or OpenID discovery) lists
+// the endpoints. Servers without metadata are assumed to host the default
+// /authorize and /token endpoints themselves. The result is kept for later
+// calls; mu is not held while fetching metadata.
+func (o *oauthClient) discover(ctx context.Context) (*oauth2.Endpoint, error) {
+	o.mu.Lock()
+	endpoint := o.endpoint
+	o.mu.Unlock()
+	if endpoint != nil {
+		return endpoint, nil
+	}
+
+	endpoint, err := o.fetchEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.endpoint == nil {
+		o.endpoint = endpoint
+	}
+	return o.endpoint, nil
+}
+
+// fetchEndpoint resolves the endpoints for discover.
+func (o *oauthClient) fetchEndpoint(ctx context.Context) (*oauth2.Endpoint, error) {
+	if o.cfg.TokenURL != "" {
+		return &oauth2.Endpoint{AuthURL: o.cfg.AuthURL, TokenURL: o.cfg.TokenURL}, nil
+	}
+
+	resource, err := url.Parse(o.resource)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: server %q: %w", o.name, err)
+	}
+
+	issuer := resource.Scheme + "://" + resource.Host
+	var prm struct {
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	if fetchMetadata(ctx, wellKnownURLs(resource, "oauth-protected-resource"), &prm) && len(prm.AuthorizationServers) > 0 {
+		issuer = prm.AuthorizationServers[0]
+	}
+
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: server %q: authorization server: %w", o.name, err)
+	}
+
+	var meta struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+	}
+	urls := append(wellKnownURLs(issuerURL, "oauth-authorization-server"), wellKnownURLs(issuerURL, "openid-configuration")...)
+	if !fetchMetadata(ctx, urls, &meta) || meta.TokenEndpoint == "" {
+		base := issuerURL.Scheme + "://" + issuerURL.Host
+		meta.AuthorizationEndpoint = base + "/authorize"
+		meta.TokenEndpoint = base + "/token"
+	}
+
+	return &oauth2.Endpoint{
+		AuthURL:   cmp.Or(o.cfg.AuthURL, meta.AuthorizationEndpoint),
+		TokenURL:  meta.TokenEndpoint,
+		AuthStyle: oauth2.AuthStyleAutoDetect,
+	}, nil
+}
+
+// wellKnownURLs lists the metadata locations for u: the path-specific one
+// first, then the one at the root of the host.
+func wellKnownURLs(u *url.URL, suffix string) []string {
+	root := u.Scheme + "://" + u.Host + "/.well-known/" + suffix
+	if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+		return []string{root + path, root}
+	}
+	return []string{root}
+}
+
+// fetchMetadata decodes the first metadata document found at urls into v.
+func fetchMetadata(ctx context.Context, urls []string, v any) bool {
+	for _, u := range urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			continue
+		}
+		err = json.NewDecoder(resp.Body).Decode(v)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationURL starts the authorization code flow for server and returns
+// the URL an operator must open to grant the agent access.
+func (m *Manager) AuthorizationURL(ctx context.Context, server string) (string, error) {
+	c := m.client(server)
+	if c == nil {
+		return "", fmt.Errorf("%w %q", ErrUnknownServer, server)
+	}
+	if c.oauth == nil || c.oauth.cfg.Type != AuthAuthorizationCode {
+		return "", fmt.Errorf("mcp: server %q does not use the authorization_code flow", server)
+	}
+
+	authURL, _, err := c.oauth.authCodeURL(ctx)
+	return authURL, err
+}
+
+// CompleteAuthorization exchanges the code returned to the redirect URL for
+// a token and reconnects the server that started the flow with state. It
+// returns the server's name.
+func (m *Manager) CompleteAuthorization(ctx context.Context, state, code string) (string, error) {
+	for _, c := range m.clients {
+		if c.oauth == nil {
+			continue
+		}
+		err := c.oauth.exchange(ctx, state, code)
+		if errors.Is(err, ErrUnknownAuthorization) {
+			continue
+		}
+		if err != nil {
+			return c.name, err
+		}
+		c.wakeUp()
+		return c.name, nil
+	}
+	return "", ErrUnknownAuthorization
+}
+
+func (m *Manager) client(name string) *Client {
+	for _, c := range m.clients {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenServer is an authorization server issuing access_token for any code
+// exchanged with a PKCE verifier.
+func tokenServer(t *testing.T, accessToken string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("code") == "" || r.Form.Get("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": accessToken, "token_type": "Bearer", "expires_in": 3600})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newAuthCodeClient(tokenURL string) *oauthClient {
+	return newOAuthClient(ServerConfig{
+		Name: "drive",
+		URL:  "https://drive.example/mcp",
+		Auth: &AuthConfig{
+			Type:        AuthAuthorizationCode,
+			ClientID:    "agent",
+			AuthURL:     "https://auth.example/authorize",
+			TokenURL:    tokenURL,
+			RedirectURL: "http://localhost/mcp/oauth/callback",
+		},
+	})
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	o := newAuthCodeClient(tokenServer(t, "t1").URL)
+	ctx := context.Background()
+
+	if o.authorized() {
+		t.Fatal("authorized before the flow completed")
+	}
+	if _, err := o.Token(); !errors.Is(err, ErrAuthorizationRequired) {
+		t.Fatalf("Token before authorization = %v, want ErrAuthorizationRequired", err)
+	}
+
+	authURL, state, err := o.authCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != state || q.Get("code_challenge_method") != "S256" || q.Get("resource") != "https://drive.example/mcp" {
+		t.Errorf("authorization URL = %s", authURL)
+	}
+
+	if err := o.exchange(ctx, "forged", "code"); !errors.Is(err, ErrUnknownAuthorization) {
+		t.Errorf("exchange with an unknown state = %v, want ErrUnknownAuthorization", err)
+	}
+	if err := o.exchange(ctx, state, "code"); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := o.Token(); err != nil || tok.AccessToken != "t1" {
+		t.Errorf("Token = %v, %v; want t1", tok, err)
+	}
+
+	// A state is used once.
+	if err := o.exchange(ctx, state, "code"); !errors.Is(err, ErrUnknownAuthorization) {
+		t.Errorf("second exchange = %v, want ErrUnknownAuthorization", err)
+	}
+}
+
+func TestPendingAuthorizationsExpire(t *testing.T) {
+	o := newAuthCodeClient(tokenServer(t, "t1").URL)
+	ctx := context.Background()
+
+	_, state, err := o.authCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := o.pending[state]
+	p.expires = time.Now().Add(-time.Second)
+	o.pending[state] = p
+
+	if err := o.exchange(ctx, state, "code"); !errors.Is(err, ErrUnknownAuthorization) {
+		t.Errorf("exchange after the state expired = %v, want ErrUnknownAuthorization", err)
+	}
+	if len(o.pending) != 0 {
+		t.Errorf("%d pending authorizations left, want the expired one dropped", len(o.pending))
+	}
+}
+
+func TestPendingAuthorizationsCapped(t *testing.T) {
+	o := newAuthCodeClient(tokenServer(t, "t1").URL)
+	ctx := context.Background()
+
+	var states []string
+	for range maxPendingAuthorizations + 4 {
+		_, state, err := o.authCodeURL(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, state)
+	}
+	if len(o.pending) != maxPendingAuthorizations {
+		t.Fatalf("%d pending authorizations, want at most %d", len(o.pending), maxPendingAuthorizations)
+	}
+
+	// The oldest were dropped; the latest can still be completed.
+	if err := o.exchange(ctx, states[0], "code"); !errors.Is(err, ErrUnknownAuthorization) {
+		t.Errorf("exchange of a dropped state = %v, want ErrUnknownAuthorization", err)
+	}
+	if err := o.exchange(ctx, states[len(states)-1], "code"); err != nil {
+		t.Errorf("exchange of the latest state: %v", err)
+	}
+}
+
+func TestExchangeDoesNotBlockTokens(t *testing.T) {
+	release := make(chan struct{})
+	exchanging := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(exchanging)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "new", "token_type": "Bearer"})
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	o := newAuthCodeClient(slow.URL)
+	o.source = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "old"})
+	ctx := context.Background()
+	_, state, err := o.authCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- o.exchange(ctx, state, "code") }()
+	<-exchanging
+
+	// Tool calls keep their token while the authorization server answers.
+	got := make(chan string, 1)
+	go func() {
+		tok, _ := o.Token()
+		got <- tok.AccessToken
+	}()
+	select {
+	case token := <-got:
+		if token != "old" {
+			t.Errorf("Token during the exchange = %q, want old", token)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Token blocked by the code exchange")
+	}
+
+	release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := o.Token(); err != nil || tok.AccessToken != "new" {
+		t.Errorf("Token after the exchange = %v, %v; want new", tok, err)
+	}
+}
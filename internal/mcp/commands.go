@@ -0,0 +1,236 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var (
+	// ErrUnknownCommand is returned by Manager.ExpandCommand when the input
+	// does not name a command; it should then be sent as typed.
+	ErrUnknownCommand = errors.New("unknown command")
+
+	// ErrInvalidCommand is returned for commands with missing or unknown
+	// arguments, and for prompts that cannot start a turn.
+	ErrInvalidCommand = errors.New("invalid command")
+)
+
+// Command is an MCP prompt offered to the user as a slash command.
+type Command struct {
+	Name        string            `json:"name"`
+	Server      string            `json:"server"`
+	Title       string            `json:"title,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Arguments   []CommandArgument `json:"arguments,omitempty"`
+}
+
+// CommandArgument describes an argument of a Command.
+type CommandArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+func (c *Client) setCommands(prompts []*mcp.Prompt) {
+	c.commandsMu.Lock()
+	defer c.commandsMu.Unlock()
+	c.commands = prompts
+}
+
+// command returns the prompt invoked as /name, if the client offers it.
+func (c *Client) command(name string) (*mcp.Prompt, bool) {
+	c.commandsMu.RLock()
+	defer c.commandsMu.RUnlock()
+
+	for _, p := range c.commands {
+		if c.qualifiedName(p.Name) == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Commands lists the slash commands of every server whose prompts are
+// exposed as commands, sorted by name.
+func (m *Manager) Commands() []Command {
+	commands := []Command{}
+	for _, c := range m.clients {
+		c.commandsMu.RLock()
+		for _, p := range c.commands {
+			cmd := Command{Name: c.qualifiedName(p.Name), Server: c.name, Title: p.Title, Description: p.Description}
+			for _, arg := range p.Arguments {
+				cmd.Arguments = append(cmd.Arguments, CommandArgument{Name: arg.Name, Description: arg.Description, Required: arg.Required})
+			}
+			commands = append(commands, cmd)
+		}
+		c.commandsMu.RUnlock()
+	}
+
+	slices.SortFunc(commands, func(a, b Command) int { return strings.Compare(a.Name, b.Name) })
+	return commands
+}
+
+// ExpandCommand runs a slash command such as
+//
+//	/summarize_ticket id=123
+//
+// Arguments are given as name=value, with double quotes around values that
+// contain spaces; bare values fill the remaining arguments in order, the last
+// one taking the rest of the line. The prompt's messages are returned as
+// conversation turns, except for the final user message, which is returned
+// as the text to send for this turn.
+func (m *Manager) ExpandCommand(ctx context.Context, input string) (turns []model.Content, prompt string, err error) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(input), "/"), " ")
+
+	var (
+		client *Client
+		p      *mcp.Prompt
+	)
+	for _, c := range m.clients {
+		if found, ok := c.command(name); ok {
+			client, p = c, found
+			break
+		}
+	}
+	if p == nil {
+		return nil, "", fmt.Errorf("%w: /%s", ErrUnknownCommand, name)
+	}
+
+	args, err := commandArguments(p, rest)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: /%s: %v", ErrInvalidCommand, name, err)
+	}
+
+	result, err := client.GetPrompt(ctx, p.Name, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, msg := range result.Messages {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+		if part, ok := promptPart(msg.Content); ok && (part.Text != "" || part.InlineData != nil) {
+			turns = append(turns, model.Content{Role: role, Parts: []model.Part{part}})
+		}
+	}
+
+	if len(turns) == 0 {
+		return nil, "", fmt.Errorf("%w: /%s: prompt returned no messages", ErrInvalidCommand, name)
+	}
+	last := turns[len(turns)-1]
+	if last.Role != "user" || last.Parts[0].Text == "" {
+		return nil, "", fmt.Errorf("%w: /%s: prompt does not end with a user text message", ErrInvalidCommand, name)
+	}
+	return turns[:len(turns)-1], last.Parts[0].Text, nil
+}
+
+// commandArguments parses the argument line of a command for prompt p.
+func commandArguments(p *mcp.Prompt, line string) (map[string]string, error) {
+	declared := make(map[string]bool, len(p.Arguments))
+	for _, arg := range p.Arguments {
+		declared[arg.Name] = true
+	}
+
+	args := map[string]string{}
+	var positional []string
+	for _, token := range splitArguments(line) {
+		key, value, ok := strings.Cut(token, "=")
+		if ok && declared[key] {
+			args[key] = value
+			continue
+		}
+		positional = append(positional, token)
+	}
+
+	var remaining []string
+	for _, arg := range p.Arguments {
+		if _, ok := args[arg.Name]; !ok {
+			remaining = append(remaining, arg.Name)
+		}
+	}
+	for i, name := range remaining {
+		if len(positional) == 0 {
+			break
+		}
+		if i == len(remaining)-1 {
+			args[name] = strings.Join(positional, " ")
+			positional = nil
+			break
+		}
+		args[name], positional = positional[0], positional[1:]
+	}
+	if len(positional) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	for _, arg := range p.Arguments {
+		if _, ok := args[arg.Name]; arg.Required && !ok {
+			return nil, fmt.Errorf("missing argument %q", arg.Name)
+		}
+	}
+	return args, nil
+}
+
+// splitArguments splits line on spaces, keeping double-quoted text together
+// and dropping the quotes.
+func splitArguments(line string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+		started bool
+	)
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case r == ' ' && !quoted:
+			if started {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if started {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// promptPart converts the content of a prompt message into a history part.
+// Images, audio and binary resources are kept as inline data; other
+// resources become text. Unknown content is dropped.
+func promptPart(content mcp.Content) (model.Part, bool) {
+	switch c := content.(type) {
+	case *mcp.TextContent:
+		return model.Part{Text: c.Text}, true
+	case *mcp.ImageContent:
+		return model.Part{InlineData: &model.InlineData{MIMEType: c.MIMEType, Data: c.Data}}, true
+	case *mcp.AudioContent:
+		return model.Part{InlineData: &model.InlineData{MIMEType: c.MIMEType, Data: c.Data}}, true
+	case *mcp.EmbeddedResource:
+		if c.Resource == nil {
+			break
+		}
+		if c.Resource.Blob != nil {
+			return model.Part{InlineData: &model.InlineData{MIMEType: c.Resource.MIMEType, Data: c.Resource.Blob, URI: c.Resource.URI}}, true
+		}
+		return model.Part{Text: fmt.Sprintf("Resource %s:\n%s", c.Resource.URI, c.Resource.Text)}, true
+	case *mcp.ResourceLink:
+		return model.Part{Text: fmt.Sprintf("Resource %s (%s)", c.URI, c.Name)}, true
+	}
+	return model.Part{}, false
+}
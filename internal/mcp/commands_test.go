@@ -0,0 +1,81 @@
+package mcp
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSplitArguments(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"a b  c ", []string{"a", "b", "c"}},
+		{`"two words" x`, []string{"two words", "x"}},
+		{`topic="vacation policy" lang=pt`, []string{"topic=vacation policy", "lang=pt"}},
+		{`"" x`, []string{"", "x"}},
+		{`"unterminated quote`, []string{"unterminated quote"}},
+	}
+	for _, tt := range tests {
+		if got := splitArguments(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("splitArguments(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCommandArguments(t *testing.T) {
+	prompt := &mcp.Prompt{
+		Name: "summarize",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "lang", Required: true},
+			{Name: "style"},
+			{Name: "topic"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want map[string]string
+		err  string
+	}{
+		{name: "positional", line: "pt short", want: map[string]string{"lang": "pt", "style": "short"}},
+		{name: "last takes the rest", line: "pt short vacation policy", want: map[string]string{"lang": "pt", "style": "short", "topic": "vacation policy"}},
+		{name: "named", line: "topic=leave lang=en", want: map[string]string{"lang": "en", "topic": "leave"}},
+		{name: "named and positional", line: `style=long pt "sick leave"`, want: map[string]string{"lang": "pt", "style": "long", "topic": "sick leave"}},
+		{name: "undeclared name is positional", line: "pt short a=b", want: map[string]string{"lang": "pt", "style": "short", "topic": "a=b"}},
+		{name: "missing required", line: "style=short", err: `missing argument "lang"`},
+		{name: "empty", line: "", err: `missing argument "lang"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commandArguments(prompt, tt.line)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("commandArguments error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("commandArguments = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Prompts without arguments take none.
+	if _, err := commandArguments(&mcp.Prompt{Name: "hello"}, "extra"); err == nil || !strings.Contains(err.Error(), `unexpected argument "extra"`) {
+		t.Errorf("commandArguments with an extra argument = %v", err)
+	}
+	if got, err := commandArguments(&mcp.Prompt{Name: "hello"}, ""); err != nil || len(got) != 0 {
+		t.Errorf("commandArguments without arguments = %v, %v", got, err)
+	}
+}
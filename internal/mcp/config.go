@@ -0,0 +1,276 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Config lists the MCP servers the agent connects to. The file format follows
+// the common "mcpServers" layout used by MCP hosts:
+//
+//	{
+//	  "mcpServers": {
+//	    "crm": {"transport": "streamable", "url": "http://crm:9000", "required": true},
+//	    "wiki": {"url": "http://wiki:9000/sse", "transport": "sse", "headers": {"X-Team": "ops"}},
+//	    "summarizer": {"url": "http://sum:9000", "sampling": {"maxTokens": 1024, "requestsPerMinute": 10}},
+//	    "hr": {"url": "https://hr/mcp", "auth": {"type": "client_credentials", "clientId": "agent", "clientSecret": "${HR_SECRET}"}},
+//	    "github": {"url": "https://gh/mcp", "tools": {"allow": ["search_*", "get_issue"], "deny": ["*delete*"]}},
+//	    "tickets": {"url": "http://tickets:9000", "promptsAs": "commands"},
+//	    "files": {"command": "mcp-files", "args": ["--root", "/srv"], "enabled": false}
+//	  }
+//	}
+type Config struct {
+	Servers map[string]ServerConfig `json:"mcpServers"`
+}
+
+// ServerConfig describes how to reach a single MCP server.
+type ServerConfig struct {
+	// Name identifies the server in logs. It is filled from the map key.
+	Name string `json:"-"`
+
+	// Transport selects the transport: "streamable" (default for URLs), "sse" or
+	// "stdio" (default for commands).
+	Transport TransportType `json:"transport,omitempty"`
+
+	// URL is the HTTP endpoint for the streamable and sse transports.
+	URL string `json:"url,omitempty"`
+
+	// Command, Args and Env describe a local server process.
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+
+	// Headers are added to every HTTP request sent to the server.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Enabled defaults to true; set it to false to keep an entry without connecting.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Prefix namespaces the server's tools and prompts as "<prefix>__<name>".
+	Prefix string `json:"prefix,omitempty"`
+
+	// OnCollision decides what happens when a tool or prompt name is already
+	// registered: "error" (default), "skip" or "override".
+	OnCollision CollisionPolicy `json:"onCollision,omitempty"`
+
+	// Required servers abort startup when they cannot be reached. Optional
+	// servers (the default) are logged and skipped.
+	Required bool `json:"required,omitempty"`
+
+	// Sampling lets the server request completions from the agent's LLM
+	// provider. Servers without it cannot sample.
+	Sampling *SamplingConfig `json:"sampling,omitempty"`
+
+	// Auth sets the credentials used to reach an HTTP server.
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// ForwardUserToken sends the end user's identity token with every tool
+	// call and resource read, in the request's _meta as "user_token", so the
+	// server can apply per-user permissions. Resources read that way are not
+	// cached.
+	ForwardUserToken bool `json:"forwardUserToken,omitempty"`
+
+	// PromptsAs decides how the server's prompts reach the agent: as tools
+	// the model may call ("tools", the default) or as slash commands the user
+	// types in a prompt ("commands").
+	PromptsAs PromptMode `json:"promptsAs,omitempty"`
+
+	// Tools and Prompts select which of the server's tools and prompts are
+	// registered and override how they are described to the model.
+	Tools   *Filter `json:"tools,omitempty"`
+	Prompts *Filter `json:"prompts,omitempty"`
+}
+
+// Filter selects tools or prompts by their name on the server, before any
+// prefix is applied. Patterns are exact names or globs ("search_*",
+// "*delete*"); deny wins over allow, and an empty allow list allows all.
+type Filter struct {
+	Allow     []string            `json:"allow,omitempty"`
+	Deny      []string            `json:"deny,omitempty"`
+	Overrides map[string]Override `json:"overrides,omitempty"`
+}
+
+// Override replaces what the server says about a tool or prompt.
+type Override struct {
+	// Description replaces the description shown to the model.
+	Description string `json:"description,omitempty"`
+
+	// InputSchema replaces a tool's input schema, typically to tighten it
+	// with enums, patterns or fewer properties. Arguments are validated
+	// against it before the call reaches the server. Not valid for prompts.
+	InputSchema map[string]any `json:"inputSchema,omitempty"`
+}
+
+// AuthType selects how the client authenticates to a server.
+type AuthType string
+
+const (
+	// AuthBearer sends a static bearer token.
+	AuthBearer AuthType = "bearer"
+	// AuthClientCredentials obtains tokens with the OAuth 2.1 client
+	// credentials grant, as a service identity.
+	AuthClientCredentials AuthType = "client_credentials"
+	// AuthAuthorizationCode obtains tokens with the OAuth 2.1 authorization
+	// code grant with PKCE, authorized once by an operator in a browser.
+	AuthAuthorizationCode AuthType = "authorization_code"
+)
+
+// AuthConfig holds a server's credentials. String values may reference
+// environment variables as ${NAME}.
+type AuthConfig struct {
+	Type AuthType `json:"type"`
+
+	// Token is the static token for the bearer type.
+	Token string `json:"token,omitempty"`
+
+	// ClientID, ClientSecret and Scopes identify the OAuth client.
+	ClientID     string   `json:"clientId,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	// AuthURL and TokenURL skip authorization server discovery.
+	AuthURL  string `json:"authUrl,omitempty"`
+	TokenURL string `json:"tokenUrl,omitempty"`
+
+	// RedirectURL receives the authorization code; it must route to the
+	// agent's /mcp/oauth/callback endpoint.
+	RedirectURL string `json:"redirectUrl,omitempty"`
+}
+
+// validate checks the fields required by the auth type.
+func (a *AuthConfig) validate() error {
+	switch a.Type {
+	case AuthBearer:
+		if a.Token == "" {
+			return fmt.Errorf("bearer auth requires token")
+		}
+	case AuthClientCredentials:
+		if a.ClientID == "" {
+			return fmt.Errorf("client_credentials auth requires clientId")
+		}
+	case AuthAuthorizationCode:
+		if a.ClientID == "" || a.RedirectURL == "" {
+			return fmt.Errorf("authorization_code auth requires clientId and redirectUrl")
+		}
+	default:
+		return fmt.Errorf("unknown auth type %q", a.Type)
+	}
+	return nil
+}
+
+// expandEnv replaces ${NAME} references in credentials and headers.
+func (s *ServerConfig) expandEnv() {
+	for k, v := range s.Headers {
+		s.Headers[k] = os.ExpandEnv(v)
+	}
+	if a := s.Auth; a != nil {
+		a.Token = os.ExpandEnv(a.Token)
+		a.ClientID = os.ExpandEnv(a.ClientID)
+		a.ClientSecret = os.ExpandEnv(a.ClientSecret)
+	}
+}
+
+// SamplingConfig limits the completions a server may request.
+type SamplingConfig struct {
+	// Model pins the model used for the server's requests; it defaults to the
+	// agent's model. Model preferences sent by the server are ignored.
+	Model string `json:"model,omitempty"`
+
+	// MaxTokens caps the tokens generated per request; 0 keeps the server's value.
+	MaxTokens int `json:"maxTokens,omitempty"`
+
+	// RequestsPerMinute limits how often the server may sample; 0 means unlimited.
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+}
+
+// PromptMode selects how MCP prompts are exposed.
+type PromptMode string
+
+const (
+	PromptsAsTools    PromptMode = "tools"
+	PromptsAsCommands PromptMode = "commands"
+)
+
+// CollisionPolicy selects how duplicate tool names are handled.
+type CollisionPolicy string
+
+const (
+	CollisionError    CollisionPolicy = "error"
+	CollisionSkip     CollisionPolicy = "skip"
+	CollisionOverride CollisionPolicy = "override"
+)
+
+// IsEnabled reports whether the server should be connected.
+func (s ServerConfig) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// LoadConfig reads a JSON MCP configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: read config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("mcp: parse config %q: %w", path, err)
+	}
+
+	for name, s := range cfg.Servers {
+		s.Name = name
+		if s.URL == "" && s.Command == "" {
+			return nil, fmt.Errorf("mcp: server %q: url or command must be set", name)
+		}
+		switch s.OnCollision {
+		case "", CollisionError, CollisionSkip, CollisionOverride:
+		default:
+			return nil, fmt.Errorf("mcp: server %q: unknown onCollision policy %q", name, s.OnCollision)
+		}
+		switch s.PromptsAs {
+		case "", PromptsAsTools, PromptsAsCommands:
+		default:
+			return nil, fmt.Errorf("mcp: server %q: unknown promptsAs mode %q", name, s.PromptsAs)
+		}
+		if s.Sampling != nil && (s.Sampling.MaxTokens < 0 || s.Sampling.RequestsPerMinute < 0) {
+			return nil, fmt.Errorf("mcp: server %q: sampling limits must not be negative", name)
+		}
+		if s.Auth != nil {
+			if s.URL == "" {
+				return nil, fmt.Errorf("mcp: server %q: auth requires an HTTP url", name)
+			}
+			if err := s.Auth.validate(); err != nil {
+				return nil, fmt.Errorf("mcp: server %q: %w", name, err)
+			}
+		}
+		if err := s.Tools.validate(); err != nil {
+			return nil, fmt.Errorf("mcp: server %q: tools: %w", name, err)
+		}
+		if err := s.Prompts.validate(); err != nil {
+			return nil, fmt.Errorf("mcp: server %q: prompts: %w", name, err)
+		}
+		if s.Prompts != nil {
+			for prompt, o := range s.Prompts.Overrides {
+				if o.InputSchema != nil {
+					return nil, fmt.Errorf("mcp: server %q: prompt %q: inputSchema can only override tools", name, prompt)
+				}
+			}
+		}
+		s.expandEnv()
+		cfg.Servers[name] = s
+	}
+
+	return &cfg, nil
+}
+
+// ServerList returns the configured servers sorted by name.
+func (c *Config) ServerList() []ServerConfig {
+	servers := make([]ServerConfig, 0, len(c.Servers))
+	for _, s := range c.Servers {
+		servers = append(servers, s)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers
+}
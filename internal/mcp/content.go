@@ -0,0 +1,124 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// toolResponse converts a tool result into a function response. Structured
+// content becomes the response map; otherwise the text content is returned
+// as "result". Images and audio are attached to the call so the provider can
+// forward them to the model, and embedded resources and resource links are
+// listed under "resources" with their URIs.
+func toolResponse(ctx context.Context, res *mcp.CallToolResult) map[string]any {
+	response := structuredResponse(res.StructuredContent)
+	if response == nil {
+		response = map[string]any{"result": extractText(res.Content)}
+	}
+
+	var media, resources []map[string]any
+	for _, content := range res.Content {
+		switch c := content.(type) {
+		case *mcp.ImageContent:
+			media = append(media, attachMedia(ctx, "image", c.MIMEType, c.Data, ""))
+		case *mcp.AudioContent:
+			media = append(media, attachMedia(ctx, "audio", c.MIMEType, c.Data, ""))
+		case *mcp.EmbeddedResource:
+			if c.Resource != nil {
+				resources = append(resources, resourceEntry(ctx, c.Resource))
+			}
+		case *mcp.ResourceLink:
+			link := map[string]any{"uri": c.URI, "name": c.Name}
+			if c.MIMEType != "" {
+				link["mime_type"] = c.MIMEType
+			}
+			if c.Description != "" {
+				link["description"] = c.Description
+			}
+			resources = append(resources, link)
+		}
+	}
+
+	if len(media) > 0 {
+		response["media"] = media
+	}
+	if len(resources) > 0 {
+		response["resources"] = resources
+	}
+	return response
+}
+
+// structuredResponse returns structured tool output as a response map.
+// Values that are not JSON objects are wrapped as "result".
+func structuredResponse(structured any) map[string]any {
+	if structured == nil {
+		return nil
+	}
+	if m, ok := structured.(map[string]any); ok {
+		return m
+	}
+
+	data, err := json.Marshal(structured)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err == nil && m != nil {
+		return m
+	}
+	return map[string]any{"result": structured}
+}
+
+// resourceEntry describes resource contents for a function response. Text
+// is inlined; images and audio are attached as media; other binary contents
+// are only described.
+func resourceEntry(ctx context.Context, rc *mcp.ResourceContents) map[string]any {
+	entry := map[string]any{"uri": rc.URI}
+	if rc.MIMEType != "" {
+		entry["mime_type"] = rc.MIMEType
+	}
+
+	switch {
+	case rc.Blob == nil:
+		entry["text"] = rc.Text
+	case strings.HasPrefix(rc.MIMEType, "image/"):
+		entry["media"] = attachMedia(ctx, "image", rc.MIMEType, rc.Blob, rc.URI)
+	case strings.HasPrefix(rc.MIMEType, "audio/"):
+		entry["media"] = attachMedia(ctx, "audio", rc.MIMEType, rc.Blob, rc.URI)
+	default:
+		entry["size"] = len(rc.Blob)
+		entry["note"] = "binary content is not shown"
+	}
+	return entry
+}
+
+// attachMedia attaches binary content to the running function call and
+// returns a short description of it for the JSON response.
+func attachMedia(ctx context.Context, kind, mimeType string, data []byte, uri string) map[string]any {
+	attached := agent.AttachParts(ctx, model.Part{InlineData: &model.InlineData{
+		MIMEType: mimeType,
+		Data:     data,
+		URI:      uri,
+	}})
+
+	desc := map[string]any{"type": kind, "mime_type": mimeType, "size": len(data), "attached": attached}
+	if uri != "" {
+		desc["uri"] = uri
+	}
+	return desc
+}
+
+func extractText(contents []mcp.Content) string {
+	var parts []string
+	for _, c := range contents {
+		if tc, ok := c.(*mcp.TextContent); ok {
+			parts = append(parts, tc.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,172 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// elicitationTimeout bounds how long a server waits for the user to answer.
+const elicitationTimeout = 5 * time.Minute
+
+var (
+	// ErrElicitationNotFound is returned by Elicitations.Answer for unknown,
+	// expired or already answered requests.
+	ErrElicitationNotFound = errors.New("elicitation not found")
+
+	// ErrNoElicitor is returned to a server that asks for input while no user
+	// is attached to the tool call.
+	ErrNoElicitor = errors.New("no user available to answer")
+)
+
+type elicitorKey struct{}
+
+// Elicitor asks the user behind a tool call for the input a server requested.
+type Elicitor func(ctx context.Context, server string, params *mcp.ElicitParams) (*mcp.ElicitResult, error)
+
+// WithElicitor returns a context whose MCP tool calls send elicitation
+// requests to e.
+func WithElicitor(ctx context.Context, e Elicitor) context.Context {
+	return context.WithValue(ctx, elicitorKey{}, e)
+}
+
+func elicitorFromContext(ctx context.Context) (Elicitor, bool) {
+	e, ok := ctx.Value(elicitorKey{}).(Elicitor)
+	return e, ok
+}
+
+// elicit handles elicitation/create. MCP does not say which tool call a
+// request belongs to, so it is only answered when a single call is in
+// flight on the client, and that call has a user attached. With several
+// calls, from any caller, the request could reach the wrong user and is
+// refused.
+func (c *Client) elicit(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+	c.callsMu.Lock()
+	var callCtx context.Context
+	n := len(c.calls)
+	for _, call := range c.calls {
+		callCtx = call.ctx
+	}
+	c.callsMu.Unlock()
+
+	if n > 1 {
+		return nil, fmt.Errorf("%w: %d tool calls are in flight", ErrNoElicitor, n)
+	}
+	if callCtx == nil {
+		return nil, ErrNoElicitor
+	}
+	e, ok := elicitorFromContext(callCtx)
+	if !ok {
+		return nil, ErrNoElicitor
+	}
+
+	// Stop waiting when either the tool call or the server's request ends.
+	waitCtx, cancel := context.WithCancel(callCtx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	return e(waitCtx, c.name, req.Params)
+}
+
+// Elicitation is a request for user input, as shown to the user.
+type Elicitation struct {
+	ID      string `json:"id"`
+	Server  string `json:"server"`
+	Message string `json:"message"`
+	Schema  any    `json:"schema,omitempty"`
+}
+
+// Elicitations pairs the elicitation requests shown to users with the
+// answers they post back.
+type Elicitations struct {
+	mu      sync.Mutex
+	pending map[string]*pendingElicitation
+}
+
+type pendingElicitation struct {
+	sessionID string
+	answer    chan *mcp.ElicitResult
+}
+
+// NewElicitations creates an empty set of pending elicitations.
+func NewElicitations() *Elicitations {
+	return &Elicitations{pending: make(map[string]*pendingElicitation)}
+}
+
+// Ask shows an elicitation request to the user of sessionID through publish
+// and waits for the answer. If the user does not answer in time or ctx ends,
+// the request is cancelled.
+func (e *Elicitations) Ask(ctx context.Context, sessionID, server string, params *mcp.ElicitParams, publish func(Elicitation) error) (*mcp.ElicitResult, error) {
+	id, err := newElicitationID()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pendingElicitation{sessionID: sessionID, answer: make(chan *mcp.ElicitResult, 1)}
+	e.mu.Lock()
+	e.pending[id] = p
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		delete(e.pending, id)
+		e.mu.Unlock()
+	}()
+
+	if err := publish(Elicitation{ID: id, Server: server, Message: params.Message, Schema: params.RequestedSchema}); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(elicitationTimeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-p.answer:
+		return result, nil
+	case <-timer.C:
+		return &mcp.ElicitResult{Action: "cancel"}, nil
+	case <-ctx.Done():
+		return &mcp.ElicitResult{Action: "cancel"}, nil
+	}
+}
+
+// Answer delivers the user's answer to a pending request. The action must
+// be "accept", "decline" or "cancel"; content is only kept on accept.
+func (e *Elicitations) Answer(sessionID, id, action string, content map[string]any) error {
+	switch action {
+	case "accept":
+	case "decline", "cancel":
+		content = nil
+	default:
+		return fmt.Errorf("mcp: unknown elicitation action %q", action)
+	}
+
+	e.mu.Lock()
+	p, ok := e.pending[id]
+	if ok && p.sessionID == sessionID {
+		delete(e.pending, id)
+	}
+	e.mu.Unlock()
+
+	if !ok || p.sessionID != sessionID {
+		return ErrElicitationNotFound
+	}
+
+	p.answer <- &mcp.ElicitResult{Action: action, Content: content}
+	return nil
+}
+
+func newElicitationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("mcp: elicitation id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// barrier returns a function that blocks its first n callers until all of
+// them arrived; later callers pass through.
+func barrier(n int) func() {
+	var (
+		mu      sync.Mutex
+		arrived int
+		all     = make(chan struct{})
+	)
+	return func() {
+		mu.Lock()
+		if arrived++; arrived == n {
+			close(all)
+		}
+		mu.Unlock()
+		<-all
+	}
+}
+
+// elicitingServer has a confirm tool that asks the user for confirmation
+// and reports the answer. The first concurrent calls ask together and
+// return together, so all of them are in flight while they ask.
+func elicitingServer(concurrent int) *mcp.Server {
+	server := newTestServer()
+	started, asked := barrier(concurrent), barrier(concurrent)
+	server.AddTool(&mcp.Tool{Name: "confirm", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			started()
+			res, err := req.Session.Elicit(ctx, &mcp.ElicitParams{
+				Message:         "Delete the page?",
+				RequestedSchema: map[string]any{"type": "object"},
+			})
+			asked()
+			if err != nil {
+				return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}}, nil
+			}
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: res.Action}}}, nil
+		})
+	return server
+}
+
+func TestElicitation(t *testing.T) {
+	c, _ := connectInMemory(t, ServerConfig{Name: "wiki"}, elicitingServer(1))
+	ctx := context.Background()
+	decls, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirm := decls[0].FunctionCall
+
+	var asked []string
+	ctx = WithElicitor(ctx, func(_ context.Context, server string, params *mcp.ElicitParams) (*mcp.ElicitResult, error) {
+		asked = append(asked, server+": "+params.Message)
+		return &mcp.ElicitResult{Action: "accept"}, nil
+	})
+	res, err := confirm(ctx, map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["result"] != "accept" {
+		t.Errorf("result = %v, want the user's answer", res)
+	}
+	if len(asked) != 1 || asked[0] != "wiki: Delete the page?" {
+		t.Errorf("elicitor asked %v", asked)
+	}
+
+	// Without a user attached to the call, the request is refused.
+	if _, err := confirm(context.Background(), map[string]any{}); err == nil || !strings.Contains(err.Error(), ErrNoElicitor.Error()) {
+		t.Errorf("call without an elicitor = %v, want %v", err, ErrNoElicitor)
+	}
+}
+
+func TestElicitationRefusedWithConcurrentCalls(t *testing.T) {
+	c, _ := connectInMemory(t, ServerConfig{Name: "wiki"}, elicitingServer(2))
+	decls, err := c.ListTools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirm := decls[0].FunctionCall
+
+	// Each call has its own user; with both in flight, the server's request
+	// cannot be attributed to either of them.
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		asked int
+		errs  []error
+	)
+	for _, user := range []string{"alice", "bob"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := WithElicitor(context.Background(), func(context.Context, string, *mcp.ElicitParams) (*mcp.ElicitResult, error) {
+				mu.Lock()
+				asked++
+				mu.Unlock()
+				return &mcp.ElicitResult{Action: "accept"}, nil
+			})
+			_, err := confirm(ctx, map[string]any{"user": user})
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if asked != 0 {
+		t.Errorf("%d users were asked, want none", asked)
+	}
+	for _, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "2 tool calls are in flight") {
+			t.Errorf("concurrent call = %v, want a refused elicitation", err)
+		}
+	}
+}
+
+func TestElicitationsAnswer(t *testing.T) {
+	e := NewElicitations()
+	published := make(chan Elicitation, 1)
+	type answer struct {
+		res *mcp.ElicitResult
+		err error
+	}
+	answered := make(chan answer, 1)
+	go func() {
+		res, err := e.Ask(context.Background(), "s1", "wiki", &mcp.ElicitParams{Message: "Name?"}, func(el Elicitation) error {
+			published <- el
+			return nil
+		})
+		answered <- answer{res, err}
+	}()
+	el := <-published
+	if el.Server != "wiki" || el.Message != "Name?" || el.ID == "" {
+		t.Fatalf("published %+v", el)
+	}
+
+	if err := e.Answer("s2", el.ID, "accept", nil); !errors.Is(err, ErrElicitationNotFound) {
+		t.Errorf("answer from another session = %v, want ErrElicitationNotFound", err)
+	}
+	if err := e.Answer("s1", el.ID, "maybe", nil); err == nil {
+		t.Error("unknown action accepted")
+	}
+	if err := e.Answer("s1", el.ID, "decline", map[string]any{"name": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	got := <-answered
+	if got.err != nil || got.res.Action != "decline" || got.res.Content != nil {
+		t.Errorf("Ask = %+v, %v; want a decline without content", got.res, got.err)
+	}
+	if err := e.Answer("s1", el.ID, "accept", nil); !errors.Is(err, ErrElicitationNotFound) {
+		t.Errorf("second answer = %v, want ErrElicitationNotFound", err)
+	}
+}
@@ -0,0 +1,98 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// validate checks the patterns and override schemas of f.
+func (f *Filter) validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string(nil), f.Allow...), f.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	for name, o := range f.Overrides {
+		if o.InputSchema == nil {
+			continue
+		}
+		if _, err := resolveSchema(o.InputSchema); err != nil {
+			return fmt.Errorf("override %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// allows reports whether name passes the filter. A nil filter allows all.
+func (f *Filter) allows(name string) bool {
+	if f == nil {
+		return true
+	}
+	if matchAny(f.Deny, name) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchAny(f.Allow, name)
+}
+
+// override returns the override configured for name, if any.
+func (f *Filter) override(name string) (Override, bool) {
+	if f == nil {
+		return Override{}, false
+	}
+	o, ok := f.Overrides[name]
+	return o, ok
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSchema compiles an input schema override, which must describe an
+// object like every tool input.
+func resolveSchema(schema map[string]any) (*jsonschema.Resolved, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var s jsonschema.Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("input schema: %w", err)
+	}
+	if s.Type != "object" {
+		return nil, fmt.Errorf(`input schema must have type "object"`)
+	}
+	resolved, err := s.Resolve(nil)
+	if err != nil {
+		return nil, fmt.Errorf("input schema: %w", err)
+	}
+	return resolved, nil
+}
+
+// inputSchemas compiles the tool input schema overrides of cfg, keyed by
+// tool name. LoadConfig has already rejected invalid ones.
+func inputSchemas(cfg ServerConfig) map[string]*jsonschema.Resolved {
+	if cfg.Tools == nil {
+		return nil
+	}
+	schemas := make(map[string]*jsonschema.Resolved)
+	for name, o := range cfg.Tools.Overrides {
+		if o.InputSchema == nil {
+			continue
+		}
+		if resolved, err := resolveSchema(o.InputSchema); err == nil {
+			schemas[name] = resolved
+		}
+	}
+	return schemas
+}
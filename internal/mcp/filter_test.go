@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestFilterAllows(t *testing.T) {
+	f := &Filter{Allow: []string{"search_*", "get_?"}, Deny: []string{"*_internal"}}
+	tests := map[string]bool{
+		"search_docs":          true,
+		"search_docs_internal": false,
+		"get_x":                true,
+		"get_xy":               false,
+		"delete_all":           false,
+	}
+	for name, want := range tests {
+		if got := f.allows(name); got != want {
+			t.Errorf("allows(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	denyOnly := &Filter{Deny: []string{"delete_*"}}
+	if !denyOnly.allows("search_docs") || denyOnly.allows("delete_all") {
+		t.Error("a filter without allow patterns must allow everything not denied")
+	}
+	if !(*Filter)(nil).allows("anything") {
+		t.Error("nil filter denied a name")
+	}
+}
+
+func TestLoadConfigFilters(t *testing.T) {
+	load := func(servers string) error {
+		path := filepath.Join(t.TempDir(), "mcp.json")
+		if err := os.WriteFile(path, []byte(`{"mcpServers": {"wiki": `+servers+`}}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadConfig(path)
+		return err
+	}
+
+	if err := load(`{"url": "http://wiki", "tools": {"allow": ["search_*"], "overrides": {"search": {"inputSchema": {"type": "object"}}}}}`); err != nil {
+		t.Errorf("valid filter rejected: %v", err)
+	}
+	if err := load(`{"url": "http://wiki", "tools": {"deny": ["[a-"]}}`); err == nil {
+		t.Error("malformed pattern accepted")
+	}
+	if err := load(`{"url": "http://wiki", "tools": {"overrides": {"search": {"inputSchema": {"type": "string"}}}}}`); err == nil {
+		t.Error("non-object input schema accepted")
+	}
+}
+
+func TestFilteredTools(t *testing.T) {
+	server := newTestServer()
+	reached := map[string]bool{}
+	for _, name := range []string{"search_docs", "search_web", "delete_page", "admin_reset"} {
+		server.AddTool(&mcp.Tool{Name: name, Description: "server description", InputSchema: map[string]any{"type": "object"}},
+			func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				reached[req.Params.Name] = true
+				return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "ok"}}}, nil
+			})
+	}
+	for _, name := range []string{"summarize", "internal_audit"} {
+		server.AddPrompt(&mcp.Prompt{Name: name, Description: "server description"},
+			func(context.Context, *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+				return &mcp.GetPromptResult{Messages: []*mcp.PromptMessage{{Role: "user", Content: &mcp.TextContent{Text: "go"}}}}, nil
+			})
+	}
+
+	c, _ := connectInMemory(t, ServerConfig{
+		Name: "wiki",
+		Tools: &Filter{
+			Allow: []string{"search_*", "delete_*"},
+			Deny:  []string{"delete_*"},
+			Overrides: map[string]Override{
+				"search_docs": {
+					Description: "Search the HR wiki.",
+					InputSchema: map[string]any{
+						"type":       "object",
+						"properties": map[string]any{"query": map[string]any{"type": "string"}},
+						"required":   []any{"query"},
+					},
+				},
+			},
+		},
+		Prompts: &Filter{
+			Deny:      []string{"internal_*"},
+			Overrides: map[string]Override{"summarize": {Description: "Summarize a page."}},
+		},
+	}, server)
+	ctx := context.Background()
+
+	decls, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range decls {
+		names = append(names, d.Name)
+		if d.Name == "search_docs" && d.Description != "Search the HR wiki." {
+			t.Errorf("search_docs description = %q, want the override", d.Description)
+		}
+		if d.Name == "search_web" && d.Description != "server description" {
+			t.Errorf("search_web description = %q, want the server's", d.Description)
+		}
+	}
+	slices.Sort(names)
+	if strings.Join(names, ",") != "search_docs,search_web" {
+		t.Fatalf("tools = %v, want only the allowed and not denied ones", names)
+	}
+
+	// Arguments are checked against the override schema before the call.
+	searchDocs := decls[slices.IndexFunc(decls, func(d *agent.FunctionDeclaration) bool { return d.Name == "search_docs" })]
+	if _, err := searchDocs.FunctionCall(ctx, map[string]any{}); err == nil || !strings.Contains(err.Error(), "invalid arguments") {
+		t.Errorf("call without the required argument = %v", err)
+	}
+	if reached["search_docs"] {
+		t.Error("invalid call reached the server")
+	}
+	if _, err := searchDocs.FunctionCall(ctx, map[string]any{"query": "vacation"}); err != nil || !reached["search_docs"] {
+		t.Errorf("valid call = %v, reached server: %v", err, reached["search_docs"])
+	}
+
+	prompts, err := c.ListPrompts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 1 || prompts[0].Name != "summarize" || prompts[0].Description != "Summarize a page." {
+		t.Errorf("prompts = %+v, want summarize with its override", prompts)
+	}
+	if _, err := c.GetPrompt(ctx, "internal_audit", nil); err == nil {
+		t.Error("denied prompt was fetched")
+	}
+}
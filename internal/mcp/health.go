@@ -0,0 +1,222 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// pingInterval is how often a connected server is pinged.
+	pingInterval = 30 * time.Second
+
+	// pingTimeout bounds a single ping; a server that does not answer in time
+	// is treated as gone and reconnected.
+	pingTimeout = 10 * time.Second
+
+	// connectTimeout bounds a single reconnect attempt.
+	connectTimeout = 30 * time.Second
+
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+)
+
+// ErrServerUnavailable is returned by tool and prompt calls while the
+// server's session is down and being re-established.
+var ErrServerUnavailable = errors.New("mcp server unavailable")
+
+// ServerState describes the connection state of an MCP server.
+type ServerState string
+
+const (
+	StateConnecting   ServerState = "connecting"
+	StateConnected    ServerState = "connected"
+	StateReconnecting ServerState = "reconnecting"
+	StateClosed       ServerState = "closed"
+)
+
+// ServerStatus is a snapshot of a server's health, as reported by /healthz.
+type ServerStatus struct {
+	Name      string      `json:"name"`
+	State     ServerState `json:"state"`
+	Required  bool        `json:"required"`
+	Error     string      `json:"error,omitempty"`
+	LastPing  time.Time   `json:"last_ping,omitzero"`
+	LatencyMS float64     `json:"latency_ms,omitempty"`
+	Since     time.Time   `json:"since"`
+}
+
+// Status returns the current health of the server.
+func (c *Client) Status() ServerStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s := c.status
+	s.Required = c.cfg.Required
+	return s
+}
+
+func (c *Client) unavailable(cause error) error {
+	if cause == nil || cause.Error() == "" {
+		return fmt.Errorf("server %q: %w", c.name, ErrServerUnavailable)
+	}
+	return fmt.Errorf("server %q: %w: %v", c.name, ErrServerUnavailable, cause)
+}
+
+func (c *Client) setSession(session *mcp.ClientSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		session.Close()
+		return
+	}
+	c.session = session
+	c.status = ServerStatus{Name: c.name, State: StateConnected, Since: time.Now()}
+}
+
+func (c *Client) setUnavailable(cause error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	if c.status.State != StateReconnecting {
+		c.status.Since = time.Now()
+	}
+	c.status.State = StateReconnecting
+	c.status.Error = ""
+	if cause != nil {
+		c.status.Error = cause.Error()
+	}
+}
+
+// wakeUp makes a pending reconnect attempt start now.
+func (c *Client) wakeUp() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed
+}
+
+// supervise keeps the client connected until Close is called. It pings the
+// current session periodically and, once the session ends (a crashed stdio
+// process, a dropped HTTP stream or a failed ping), reconnects with
+// exponential backoff and re-syncs tools and prompts. A nil session starts
+// straight in the reconnect loop.
+func (c *Client) supervise(session *mcp.ClientSession) {
+	for {
+		if session != nil {
+			err := c.watch(session)
+			if c.isClosed() {
+				return
+			}
+			log.Printf("mcp: server %q: connection lost: %v", c.name, err)
+			c.setUnavailable(err)
+		}
+
+		session = c.reconnect()
+		if session == nil {
+			return
+		}
+
+		log.Printf("mcp: server %q: reconnected", c.name)
+		c.setSession(session)
+		c.resetCache()
+		c.refresh("tools", c.syncTools)
+		c.refresh("prompts", c.syncPrompts)
+		c.refresh("resources", c.syncResources)
+	}
+}
+
+// watch pings session until it ends and returns the reason.
+func (c *Client) watch(session *mcp.ClientSession) error {
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				err = mcp.ErrConnectionClosed
+			}
+			return err
+		case <-c.stop:
+			return nil
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			err := c.ping(ctx, session)
+			cancel()
+			if err != nil {
+				session.Close()
+				<-done
+				return fmt.Errorf("ping: %w", err)
+			}
+		}
+	}
+}
+
+// Ping checks that the server answers on its current session, recording the
+// latency in the server's status. It fails fast while the server is
+// disconnected.
+func (c *Client) Ping(ctx context.Context) error {
+	session, err := c.liveSession()
+	if err != nil {
+		return err
+	}
+	return c.ping(ctx, session)
+}
+
+func (c *Client) ping(ctx context.Context, session *mcp.ClientSession) error {
+	start := time.Now()
+	err := session.Ping(ctx, nil)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.status.LastPing = start
+		c.status.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+		c.status.Error = ""
+	}
+	return err
+}
+
+// reconnect dials the server until it succeeds, backing off exponentially
+// between attempts. It returns nil once the client is closed.
+func (c *Client) reconnect() *mcp.ClientSession {
+	backoff := minReconnectBackoff
+	for {
+		select {
+		case <-c.stop:
+			return nil
+		case <-c.wake:
+			backoff = minReconnectBackoff
+		case <-time.After(backoff):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+		session, err := c.connect(ctx)
+		cancel()
+		if err == nil {
+			return session
+		}
+
+		c.setUnavailable(err)
+		backoff = min(backoff*2, maxReconnectBackoff)
+		log.Printf("mcp: server %q: reconnect failed, retrying in %s: %v", c.name, backoff, err)
+	}
+}
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Manager connects to every server in a Config and registers their tools and
+// prompts with the agent. Optional servers that are unreachable at startup
+// keep retrying in the background and register their tools once they connect.
+type Manager struct {
+	clients []*Client
+	servers map[string]ServerConfig
+
+	// resMu guards the resource lists reported by each client and the
+	// registries their instruction section and read_resource tool are
+	// written to.
+	resMu             sync.Mutex
+	resources         map[*Client]serverResources
+	instructions      InstructionRegistry
+	tools             ToolRegistry
+	readResourceAdded bool
+}
+
+// Connect dials every enabled server in cfg. It fails only when a required
+// server cannot be reached; optional failures are logged.
+func Connect(ctx context.Context, cfg *Config) (*Manager, error) {
+	m := &Manager{servers: make(map[string]ServerConfig)}
+
+	for _, server := range cfg.ServerList() {
+		if !server.IsEnabled() {
+			log.Printf("mcp: server %q disabled", server.Name)
+			continue
+		}
+
+		m.servers[server.Name] = server
+
+		client, err := NewClientFromConfig(ctx, server)
+		if errors.Is(err, ErrAuthorizationRequired) {
+			// Waiting for an operator must not stop the agent from starting.
+			log.Printf("mcp: server %q waiting for authorization: %v", server.Name, err)
+			m.clients = append(m.clients, newReconnectingClient(server, err))
+			continue
+		}
+		if err != nil {
+			if server.Required {
+				m.Close()
+				return nil, fmt.Errorf("mcp: required server %q: %w", server.Name, err)
+			}
+			log.Printf("mcp: optional server %q unavailable, retrying in background: %v", server.Name, err)
+			m.clients = append(m.clients, newReconnectingClient(server, err))
+			continue
+		}
+
+		log.Printf("mcp: connected to %q", server.Name)
+		m.clients = append(m.clients, client)
+	}
+
+	return m, nil
+}
+
+// Clients returns the clients of every enabled server, including those that
+// are currently reconnecting.
+func (m *Manager) Clients() []*Client {
+	return m.clients
+}
+
+// RegisterTools registers the tools of every connected server.
+func (m *Manager) RegisterTools(ctx context.Context, registry ToolRegistry) error {
+	return m.each(func(c *Client) error { return c.RegisterTools(ctx, registry) })
+}
+
+// RegisterPrompts registers the prompts of every connected server.
+func (m *Manager) RegisterPrompts(ctx context.Context, registry ToolRegistry) error {
+	return m.each(func(c *Client) error { return c.RegisterPrompts(ctx, registry) })
+}
+
+// Status reports the health of every enabled server.
+func (m *Manager) Status() []ServerStatus {
+	statuses := make([]ServerStatus, 0, len(m.clients))
+	for _, c := range m.clients {
+		statuses = append(statuses, c.Status())
+	}
+	return statuses
+}
+
+// Close terminates every MCP session.
+func (m *Manager) Close() {
+	for _, c := range m.clients {
+		c.Close()
+	}
+}
+
+// each runs fn for every client, tolerating failures on optional servers and
+// on servers still waiting to be authorized.
+func (m *Manager) each(fn func(c *Client) error) error {
+	for _, c := range m.clients {
+		if err := fn(c); err != nil {
+			if m.servers[c.name].Required && !c.awaitingAuthorization() {
+				return fmt.Errorf("mcp: server %q: %w", c.name, err)
+			}
+			log.Printf("mcp: optional server %q: %v", c.name, err)
+		}
+	}
+	return nil
+}
@@ -2,9 +2,12 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/m2tx/agent_example/internal/agent"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -14,76 +17,278 @@ type TransportType string
 const (
 	TransportSSE        TransportType = "sse"
 	TransportStreamable TransportType = "streamable"
+	TransportStdio      TransportType = "stdio"
 )
 
 // ToolRegistry is implemented by any type that can accept tool registrations.
+// AddFunctionCall must return an error wrapping agent.ErrFunctionExists for
+// duplicate names; SetFunctionCall replaces an existing entry.
 type ToolRegistry interface {
 	AddFunctionCall(*agent.FunctionDeclaration) error
+	SetFunctionCall(*agent.FunctionDeclaration) error
+	RemoveFunctionCall(name string)
 }
 
-// Client wraps an MCP client session.
+// InstructionRegistry is implemented by any type whose system instruction can
+// be extended with named sections. An empty text removes the section.
+type InstructionRegistry interface {
+	SetInstructionSection(name, text string)
+}
+
+// toolNameSeparator joins a server prefix and a tool or prompt name.
+const toolNameSeparator = "__"
+
+// Client wraps an MCP client session. The session is re-established
+// transparently, with backoff, when the server goes away; for stdio servers
+// that means restarting the process.
 type Client struct {
+	name   string
+	cfg    ServerConfig
+	client *mcp.Client
+	oauth  *oauthClient
+	stop   chan struct{}
+	// wake cuts a reconnect backoff short, e.g. once the server is authorized.
+	wake chan struct{}
+
+	mu      sync.RWMutex
 	session *mcp.ClientSession
+	closed  bool
+	status  ServerStatus
+	sampler *Sampler
+
+	samplingLimiter *rateLimiter
+
+	// inputSchemas holds the configured tool input schema overrides, which
+	// arguments are validated against before a call.
+	inputSchemas map[string]*jsonschema.Resolved
+
+	// callsMu guards the tool calls in flight, keyed by progress token, used
+	// to route progress notifications and elicitation requests.
+	callsMu sync.Mutex
+	calls   map[string]*toolCall
+
+	// regMu guards the registries and the names this client registered in them.
+	regMu          sync.Mutex
+	toolRegistry   ToolRegistry
+	promptRegistry ToolRegistry
+	tools          map[string]bool
+	prompts        map[string]bool
+
+	// commandsMu guards the prompts exposed as slash commands.
+	commandsMu sync.RWMutex
+	commands   []*mcp.Prompt
+
+	// Resources are listed only once the Manager registers them; onResources
+	// receives the lists whenever they change. Both are guarded by regMu.
+	resourcesEnabled bool
+	onResources      func(*Client, []*mcp.Resource, []*mcp.ResourceTemplate)
+
+	// cacheMu guards the contents of subscribed resources, which stay cached
+	// until the server reports an update.
+	cacheMu    sync.Mutex
+	cache      map[string]*mcp.ReadResourceResult
+	subscribed map[string]bool
 }
 
 // NewClient creates and connects an MCP client using an HTTP endpoint.
-// The transportType selects the transport: "streamable" or "sse" (default).
+// The transportType selects the transport: "streamable" (default) or "sse".
 func NewClient(ctx context.Context, endpoint string, transportType TransportType) (*Client, error) {
-	if endpoint == "" {
-		return nil, fmt.Errorf("mcp: endpoint must be set")
+	return NewClientFromConfig(ctx, ServerConfig{
+		Name:      "default",
+		URL:       endpoint,
+		Transport: transportType,
+	})
+}
+
+// NewClientFromConfig creates and connects an MCP client described by a
+// ServerConfig entry.
+func NewClientFromConfig(ctx context.Context, cfg ServerConfig) (*Client, error) {
+	c := newClient(cfg)
+
+	session, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.setSession(session)
+
+	go c.supervise(session)
+
+	return c, nil
+}
+
+// newReconnectingClient returns a client for a server that could not be
+// reached at startup. It reports ErrServerUnavailable until a background
+// reconnect succeeds, at which point its tools and prompts are registered.
+func newReconnectingClient(cfg ServerConfig, cause error) *Client {
+	c := newClient(cfg)
+	c.setUnavailable(cause)
+
+	go c.supervise(nil)
+
+	return c
+}
+
+func newClient(cfg ServerConfig) *Client {
+	c := &Client{
+		name:   cfg.Name,
+		cfg:    cfg,
+		oauth:  newOAuthClient(cfg),
+		stop:   make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+		status: ServerStatus{Name: cfg.Name, State: StateConnecting},
+
+		inputSchemas: inputSchemas(cfg),
+	}
+	opts := &mcp.ClientOptions{
+		ToolListChangedHandler: func(context.Context, *mcp.ToolListChangedRequest) {
+			go c.refresh("tools", c.syncTools)
+		},
+		PromptListChangedHandler: func(context.Context, *mcp.PromptListChangedRequest) {
+			go c.refresh("prompts", c.syncPrompts)
+		},
+		ResourceListChangedHandler: func(context.Context, *mcp.ResourceListChangedRequest) {
+			go c.refresh("resources", c.syncResources)
+		},
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			c.invalidate(req.Params.URI)
+		},
+		ElicitationHandler:          c.elicit,
+		ProgressNotificationHandler: c.progress,
+	}
+	// The sampling capability is only advertised to servers allowed to use it.
+	if cfg.Sampling != nil {
+		c.samplingLimiter = newRateLimiter(cfg.Sampling.RequestsPerMinute)
+		opts.CreateMessageHandler = c.createMessage
+	}
+	c.client = mcp.NewClient(&mcp.Implementation{Name: "agent_example", Version: "1.0.0"}, opts)
+	return c
+}
+
+func (c *Client) connect(ctx context.Context) (*mcp.ClientSession, error) {
+	if c.oauth != nil && !c.oauth.authorized() {
+		return nil, fmt.Errorf("mcp connect: server %q: %w", c.name, ErrAuthorizationRequired)
 	}
 
-	var transport mcp.Transport
-	switch transportType {
-	case TransportSSE:
-		transport = &mcp.SSEClientTransport{Endpoint: endpoint}
-	default:
-		transport = &mcp.StreamableClientTransport{Endpoint: endpoint}
+	transport, err := newTransport(c.cfg, c.oauth)
+	if err != nil {
+		return nil, err
 	}
 
-	c := mcp.NewClient(&mcp.Implementation{Name: "agent_example", Version: "1.0.0"}, nil)
-	session, err := c.Connect(ctx, transport, &mcp.ClientSessionOptions{})
+	session, err := c.client.Connect(ctx, transport, &mcp.ClientSessionOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("mcp connect: %w", err)
 	}
 
-	return &Client{session: session}, nil
+	return session, nil
+}
+
+// liveSession returns the current session, or an ErrServerUnavailable error
+// while the server is disconnected.
+func (c *Client) liveSession() (*mcp.ClientSession, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.session == nil || c.status.State != StateConnected {
+		return nil, c.unavailable(errors.New(c.status.Error))
+	}
+	return c.session, nil
+}
+
+// Name returns the configured server name.
+func (c *Client) Name() string {
+	return c.name
 }
 
-// Close terminates the underlying MCP session.
+// Close terminates the underlying MCP session. For stdio servers this also
+// stops the server process.
 func (c *Client) Close() {
-	c.session.Close()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.status.State = StateClosed
+	session := c.session
+	c.mu.Unlock()
+
+	close(c.stop)
+	if session != nil {
+		session.Close()
+	}
 }
 
-// ListTools fetches all tools from the MCP server and returns them as FunctionDeclarations.
+// ListTools fetches the tools from the MCP server that pass the configured
+// filter and returns them as FunctionDeclarations, with any configured
+// description and input schema overrides applied.
 func (c *Client) ListTools(ctx context.Context) ([]*agent.FunctionDeclaration, error) {
-	result, err := c.session.ListTools(ctx, nil)
+	session, err := c.liveSession()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := session.ListTools(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("mcp list tools: %w", err)
 	}
 
 	decls := make([]*agent.FunctionDeclaration, 0, len(result.Tools))
 	for _, tool := range result.Tools {
+		if !c.cfg.Tools.allows(tool.Name) {
+			continue
+		}
+		if o, ok := c.cfg.Tools.override(tool.Name); ok {
+			if o.Description != "" {
+				tool.Description = o.Description
+			}
+			if o.InputSchema != nil {
+				tool.InputSchema = o.InputSchema
+			}
+		}
+		schema := c.inputSchemas[tool.Name]
+
 		decls = append(decls, &agent.FunctionDeclaration{
-			Name:             tool.Name,
+			Name:             c.qualifiedName(tool.Name),
 			Description:      tool.Description,
 			ParametersSchema: tool.InputSchema,
 			FunctionCall: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				if schema != nil {
+					if err := schema.Validate(args); err != nil {
+						return nil, fmt.Errorf("tool %s: invalid arguments: %w", tool.Name, err)
+					}
+				}
+				// Meta must be non-nil: SetProgressToken does not allocate it.
 				params := &mcp.CallToolParams{
 					Name:      tool.Name,
 					Arguments: args,
+					Meta:      mcp.Meta{},
 				}
 				if sessionID, ok := agent.SessionIDFromContext(ctx); ok {
-					params.Meta = mcp.Meta{"session_id": sessionID}
+					params.Meta["session_id"] = sessionID
+				}
+				if token, ok := agent.UserTokenFromContext(ctx); ok && c.cfg.ForwardUserToken {
+					params.Meta["user_token"] = token
+				}
+				session, err := c.liveSession()
+				if err != nil {
+					return nil, fmt.Errorf("mcp call %s: %w", tool.Name, err)
+				}
+				// Cancelling ctx, e.g. when the chat client disconnects, makes
+				// the SDK send notifications/cancelled for the call.
+				token, done := c.trackCall(ctx, c.qualifiedName(tool.Name))
+				defer done()
+				params.SetProgressToken(token)
+				res, err := session.CallTool(ctx, params)
+				if errors.Is(err, mcp.ErrConnectionClosed) {
+					return nil, fmt.Errorf("mcp call %s: %w", tool.Name, c.unavailable(err))
 				}
-				res, err := c.session.CallTool(ctx, params)
 				if err != nil {
 					return nil, fmt.Errorf("mcp call %s: %w", tool.Name, err)
 				}
 				if res.IsError {
 					return nil, fmt.Errorf("tool %s: %s", tool.Name, extractText(res.Content))
 				}
-				return map[string]any{"result": extractText(res.Content)}, nil
+				return toolResponse(ctx, res), nil
 			},
 		})
 	}
@@ -91,34 +296,42 @@ func (c *Client) ListTools(ctx context.Context) ([]*agent.FunctionDeclaration, e
 	return decls, nil
 }
 
-// RegisterTools fetches all tools from the MCP server and registers them with the given registry.
+// RegisterTools fetches all tools from the MCP server and registers them with
+// the given registry. The registry is kept up to date afterwards whenever the
+// server sends notifications/tools/list_changed.
 func (c *Client) RegisterTools(ctx context.Context, registry ToolRegistry) error {
-	decls, err := c.ListTools(ctx)
-	if err != nil {
-		return err
-	}
+	c.regMu.Lock()
+	defer c.regMu.Unlock()
 
-	for _, decl := range decls {
-		if err := registry.AddFunctionCall(decl); err != nil {
-			return fmt.Errorf("register tool %q: %w", decl.Name, err)
-		}
-	}
-
-	return nil
+	c.toolRegistry = registry
+	return c.syncTools(ctx)
 }
 
 // RegisterPrompts fetches all prompts from the MCP server and registers each one
 // as a callable tool. When invoked, the tool calls GetPrompt with the supplied
-// arguments and returns the rendered messages as a single text result.
+// arguments and returns the rendered messages as a single text result. The
+// registry is kept up to date on notifications/prompts/list_changed. Servers
+// configured with promptsAs "commands" register no tools; their prompts are
+// offered as slash commands instead.
 func (c *Client) RegisterPrompts(ctx context.Context, registry ToolRegistry) error {
+	c.regMu.Lock()
+	defer c.regMu.Unlock()
+
+	c.promptRegistry = registry
+	return c.syncPrompts(ctx)
+}
+
+// promptDeclarations fetches all prompts and wraps each as a FunctionDeclaration.
+func (c *Client) promptDeclarations(ctx context.Context) ([]*agent.FunctionDeclaration, error) {
 	prompts, err := c.ListPrompts(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	decls := make([]*agent.FunctionDeclaration, 0, len(prompts))
 	for _, p := range prompts {
 		decl := &agent.FunctionDeclaration{
-			Name:             p.Name,
+			Name:             c.qualifiedName(p.Name),
 			Description:      p.Description,
 			ParametersSchema: buildPromptSchema(p),
 			FunctionCall: func(ctx context.Context, args map[string]any) (map[string]any, error) {
@@ -137,12 +350,10 @@ func (c *Client) RegisterPrompts(ctx context.Context, registry ToolRegistry) err
 				return map[string]any{"messages": strings.Join(parts, "\n")}, nil
 			},
 		}
-		if err := registry.AddFunctionCall(decl); err != nil {
-			return fmt.Errorf("register prompt %q: %w", p.Name, err)
-		}
+		decls = append(decls, decl)
 	}
 
-	return nil
+	return decls, nil
 }
 
 // buildPromptSchema converts MCP prompt arguments into a JSON Schema map.
@@ -171,20 +382,46 @@ func buildPromptSchema(p *mcp.Prompt) map[string]any {
 	return schema
 }
 
-// ListPrompts fetches all prompts available on the MCP server.
+// ListPrompts fetches the prompts available on the MCP server that pass the
+// configured filter.
 func (c *Client) ListPrompts(ctx context.Context) ([]*mcp.Prompt, error) {
-	result, err := c.session.ListPrompts(ctx, nil)
+	session, err := c.liveSession()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := session.ListPrompts(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("mcp list prompts: %w", err)
 	}
 
-	return result.Prompts, nil
+	prompts := make([]*mcp.Prompt, 0, len(result.Prompts))
+	for _, p := range result.Prompts {
+		if !c.cfg.Prompts.allows(p.Name) {
+			continue
+		}
+		if o, ok := c.cfg.Prompts.override(p.Name); ok && o.Description != "" {
+			p.Description = o.Description
+		}
+		prompts = append(prompts, p)
+	}
+
+	return prompts, nil
 }
 
 // GetPrompt retrieves a specific prompt by name, optionally passing arguments
 // for template substitution. Returns the resolved messages from the MCP server.
 func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]string) (*mcp.GetPromptResult, error) {
-	result, err := c.session.GetPrompt(ctx, &mcp.GetPromptParams{
+	if !c.cfg.Prompts.allows(name) {
+		return nil, fmt.Errorf("mcp get prompt %q: not allowed by configuration", name)
+	}
+
+	session, err := c.liveSession()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := session.GetPrompt(ctx, &mcp.GetPromptParams{
 		Name:      name,
 		Arguments: args,
 	})
@@ -194,13 +431,3 @@ func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]str
 
 	return result, nil
 }
-
-func extractText(contents []mcp.Content) string {
-	var parts []string
-	for _, c := range contents {
-		if tc, ok := c.(*mcp.TextContent); ok {
-			parts = append(parts, tc.Text)
-		}
-	}
-	return strings.Join(parts, "\n")
-}
@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ToolProgress is a progress update sent by a server during a tool call.
+// Total is zero when the server does not know how much work remains.
+type ToolProgress struct {
+	// CallID is the agent's ID of the tool call, if it made the call.
+	CallID   string  `json:"call_id,omitempty"`
+	Tool     string  `json:"tool"`
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context whose MCP tool calls report progress
+// notifications to fn.
+func WithProgress(ctx context.Context, fn func(ToolProgress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// toolCall is a tool call in flight, identified by its progress token.
+type toolCall struct {
+	ctx  context.Context
+	tool string
+}
+
+// progressTokens numbers tool calls across all clients.
+var progressTokens atomic.Uint64
+
+// trackCall records a tool call in flight so that progress notifications and
+// elicitation requests the server sends while handling it can be routed to
+// the caller. It returns the call's progress token and a function that must
+// be called when the call returns.
+func (c *Client) trackCall(ctx context.Context, tool string) (string, func()) {
+	token := fmt.Sprintf("%s-%d", c.name, progressTokens.Add(1))
+
+	c.callsMu.Lock()
+	defer c.callsMu.Unlock()
+
+	if c.calls == nil {
+		c.calls = make(map[string]*toolCall)
+	}
+	c.calls[token] = &toolCall{ctx: ctx, tool: tool}
+
+	return token, func() {
+		c.callsMu.Lock()
+		defer c.callsMu.Unlock()
+		delete(c.calls, token)
+	}
+}
+
+// progress handles notifications/progress for tool calls in flight.
+func (c *Client) progress(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+	token, ok := req.Params.ProgressToken.(string)
+	if !ok {
+		return
+	}
+
+	c.callsMu.Lock()
+	call, ok := c.calls[token]
+	c.callsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	if fn, ok := call.ctx.Value(progressKey{}).(func(ToolProgress)); ok {
+		callID, _ := agent.ToolCallIDFromContext(call.ctx)
+		fn(ToolProgress{
+			CallID:   callID,
+			Tool:     call.tool,
+			Progress: req.Params.Progress,
+			Total:    req.Params.Total,
+			Message:  req.Params.Message,
+		})
+	}
+}
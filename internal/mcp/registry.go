@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/m2tx/agent_example/internal/agent"
+)
+
+// refreshTimeout bounds a re-list triggered by a list_changed notification.
+const refreshTimeout = 30 * time.Second
+
+// qualifiedName applies the configured server prefix to an MCP name.
+func (c *Client) qualifiedName(name string) string {
+	if c.cfg.Prefix == "" {
+		return name
+	}
+	return c.cfg.Prefix + toolNameSeparator + name
+}
+
+// refresh re-lists tools or prompts after a list_changed notification and
+// applies the difference to the registry. Failures are logged.
+func (c *Client) refresh(kind string, sync func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	c.regMu.Lock()
+	defer c.regMu.Unlock()
+
+	if err := sync(ctx); err != nil {
+		log.Printf("mcp: server %q: refresh %s: %v", c.name, kind, err)
+	}
+}
+
+// syncTools must be called with regMu held.
+func (c *Client) syncTools(ctx context.Context) error {
+	if c.toolRegistry == nil {
+		return nil
+	}
+
+	decls, err := c.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.tools, err = c.sync(c.toolRegistry, c.tools, decls, "tool")
+	return err
+}
+
+// syncPrompts must be called with regMu held. Servers whose prompts are
+// commands register no tools; their prompt list is kept for Manager.Commands.
+func (c *Client) syncPrompts(ctx context.Context) error {
+	if c.promptRegistry == nil {
+		return nil
+	}
+
+	if c.cfg.PromptsAs == PromptsAsCommands {
+		prompts, err := c.ListPrompts(ctx)
+		if err != nil {
+			return err
+		}
+		c.setCommands(prompts)
+		c.prompts, err = c.sync(c.promptRegistry, c.prompts, nil, "prompt")
+		return err
+	}
+
+	decls, err := c.promptDeclarations(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.prompts, err = c.sync(c.promptRegistry, c.prompts, decls, "prompt")
+	return err
+}
+
+// sync makes registry match decls for the names owned by this client:
+// entries that disappeared are removed, entries the client already owns are
+// replaced, and new entries go through the collision policy. It returns the
+// updated set of owned names.
+func (c *Client) sync(registry ToolRegistry, owned map[string]bool, decls []*agent.FunctionDeclaration, kind string) (map[string]bool, error) {
+	next := make(map[string]bool, len(decls))
+
+	for _, decl := range decls {
+		if owned[decl.Name] {
+			if err := registry.SetFunctionCall(decl); err != nil {
+				return owned, fmt.Errorf("register %s %q: %w", kind, decl.Name, err)
+			}
+			next[decl.Name] = true
+			continue
+		}
+
+		added, err := c.register(registry, decl)
+		if err != nil {
+			return owned, fmt.Errorf("register %s %q: %w", kind, decl.Name, err)
+		}
+		if added {
+			next[decl.Name] = true
+			if owned != nil {
+				log.Printf("mcp: server %q: %s %q added", c.name, kind, decl.Name)
+			}
+		}
+	}
+
+	for name := range owned {
+		if !next[name] {
+			registry.RemoveFunctionCall(name)
+			log.Printf("mcp: server %q: %s %q removed", c.name, kind, name)
+		}
+	}
+
+	return next, nil
+}
+
+// register adds decl to the registry, resolving name collisions according to
+// the server's OnCollision policy. Every collision is logged. It reports
+// whether decl ended up registered.
+func (c *Client) register(registry ToolRegistry, decl *agent.FunctionDeclaration) (bool, error) {
+	err := registry.AddFunctionCall(decl)
+	if !errors.Is(err, agent.ErrFunctionExists) {
+		return err == nil, err
+	}
+
+	switch c.cfg.OnCollision {
+	case CollisionSkip:
+		log.Printf("mcp: server %q: duplicate %q skipped, keeping the existing registration", c.name, decl.Name)
+		return false, nil
+	case CollisionOverride:
+		log.Printf("mcp: server %q: duplicate %q overrides the existing registration", c.name, decl.Name)
+		return true, registry.SetFunctionCall(decl)
+	default:
+		log.Printf("mcp: server %q: duplicate %q rejected", c.name, decl.Name)
+		return false, err
+	}
+}
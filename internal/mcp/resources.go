@@ -0,0 +1,403 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// supportsResources reports whether the connected server advertises the
+// resources capability.
+func (c *Client) supportsResources(session *mcp.ClientSession) (supported, subscribe bool) {
+	res := session.InitializeResult()
+	if res == nil || res.Capabilities == nil || res.Capabilities.Resources == nil {
+		return false, false
+	}
+	return true, res.Capabilities.Resources.Subscribe
+}
+
+// ListResources fetches the resources exposed by the MCP server. Servers
+// without the resources capability return an empty list.
+func (c *Client) ListResources(ctx context.Context) ([]*mcp.Resource, error) {
+	session, err := c.liveSession()
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := c.supportsResources(session); !ok {
+		return nil, nil
+	}
+
+	result, err := session.ListResources(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("mcp list resources: %w", err)
+	}
+
+	return result.Resources, nil
+}
+
+// ListResourceTemplates fetches the resource templates exposed by the MCP
+// server. Servers without the resources capability return an empty list.
+func (c *Client) ListResourceTemplates(ctx context.Context) ([]*mcp.ResourceTemplate, error) {
+	session, err := c.liveSession()
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := c.supportsResources(session); !ok {
+		return nil, nil
+	}
+
+	result, err := session.ListResourceTemplates(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("mcp list resource templates: %w", err)
+	}
+
+	return result.ResourceTemplates, nil
+}
+
+// ReadResource reads the resource at uri. When the server supports
+// subscriptions the client subscribes to the resource and serves later reads
+// from a cache until the server reports an update. Reads made with the end
+// user's token, when the server is configured to receive it, may return
+// content only that user can see, so they are never cached.
+func (c *Client) ReadResource(ctx context.Context, uri string) (*mcp.ReadResourceResult, error) {
+	params := &mcp.ReadResourceParams{URI: uri}
+	token, perUser := agent.UserTokenFromContext(ctx)
+	perUser = perUser && c.cfg.ForwardUserToken
+	if perUser {
+		params.Meta = mcp.Meta{"user_token": token}
+	} else {
+		c.cacheMu.Lock()
+		cached, ok := c.cache[uri]
+		c.cacheMu.Unlock()
+		if ok {
+			return cached, nil
+		}
+	}
+
+	session, err := c.liveSession()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := session.ReadResource(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("mcp read resource %q: %w", uri, err)
+	}
+	if perUser {
+		return result, nil
+	}
+
+	if _, subscribe := c.supportsResources(session); subscribe && c.subscribe(ctx, session, uri) {
+		c.cacheMu.Lock()
+		if c.cache == nil {
+			c.cache = make(map[string]*mcp.ReadResourceResult)
+		}
+		c.cache[uri] = result
+		c.cacheMu.Unlock()
+	}
+
+	return result, nil
+}
+
+// subscribe subscribes to updates for uri once per session and reports
+// whether the subscription is active.
+func (c *Client) subscribe(ctx context.Context, session *mcp.ClientSession, uri string) bool {
+	c.cacheMu.Lock()
+	done := c.subscribed[uri]
+	c.cacheMu.Unlock()
+	if done {
+		return true
+	}
+
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err != nil {
+		log.Printf("mcp: server %q: subscribe %q: %v", c.name, uri, err)
+		return false
+	}
+
+	c.cacheMu.Lock()
+	if c.subscribed == nil {
+		c.subscribed = make(map[string]bool)
+	}
+	c.subscribed[uri] = true
+	c.cacheMu.Unlock()
+	return true
+}
+
+// invalidate drops cached content for uri. Servers may report an update for
+// a sub-resource of the subscribed URI, so the cached resources containing
+// it are dropped too.
+func (c *Client) invalidate(uri string) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	for cached := range c.cache {
+		if containsResource(cached, uri) {
+			delete(c.cache, cached)
+		}
+	}
+}
+
+// containsResource reports whether uri is parent or below it, at a path
+// segment boundary: file:///a contains file:///a/b but not file:///ab.
+func containsResource(parent, uri string) bool {
+	if uri == parent {
+		return true
+	}
+	if !strings.HasPrefix(uri, parent) {
+		return false
+	}
+	return strings.HasSuffix(parent, "/") || uri[len(parent)] == '/'
+}
+
+// resetCache forgets cached content and subscriptions, which do not survive
+// a new session.
+func (c *Client) resetCache() {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.cache = nil
+	c.subscribed = nil
+}
+
+// registerResources enables resource listing for this client and reports
+// the lists to onChange now and whenever the server changes them.
+func (c *Client) registerResources(ctx context.Context, onChange func(*Client, []*mcp.Resource, []*mcp.ResourceTemplate)) error {
+	c.regMu.Lock()
+	defer c.regMu.Unlock()
+
+	c.resourcesEnabled = true
+	c.onResources = onChange
+	return c.syncResources(ctx)
+}
+
+// syncResources must be called with regMu held.
+func (c *Client) syncResources(ctx context.Context) error {
+	if !c.resourcesEnabled {
+		return nil
+	}
+
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		return err
+	}
+	templates, err := c.ListResourceTemplates(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Listed content may have changed along with the list.
+	c.cacheMu.Lock()
+	c.cache = nil
+	c.cacheMu.Unlock()
+
+	if c.onResources != nil {
+		c.onResources(c, resources, templates)
+	}
+	return nil
+}
+
+const (
+	// readResourceTool is the name of the tool the model uses to read resources.
+	readResourceTool = "read_resource"
+
+	// resourcesSection names the system instruction block listing resources.
+	resourcesSection = "mcp_resources"
+
+	// maxListedResources caps how many resources of one server are listed in
+	// the system instruction; the rest can still be read by URI.
+	maxListedResources = 50
+)
+
+// serverResources holds the last resource lists reported by a client.
+type serverResources struct {
+	resources []*mcp.Resource
+	templates []*mcp.ResourceTemplate
+}
+
+// RegisterResources exposes the resources of every server to the agent: the
+// available resources and templates are listed in a system instruction
+// section, and a generic read_resource tool is added to registry while any
+// server exposes some. Both are kept current on
+// notifications/resources/list_changed.
+func (m *Manager) RegisterResources(ctx context.Context, registry ToolRegistry, instructions InstructionRegistry) error {
+	m.resMu.Lock()
+	m.tools = registry
+	m.instructions = instructions
+	m.resources = make(map[*Client]serverResources)
+	m.resMu.Unlock()
+
+	return m.each(func(c *Client) error { return c.registerResources(ctx, m.setResources) })
+}
+
+// setResources records the lists reported by c and rebuilds the
+// instruction section and the read_resource tool.
+func (m *Manager) setResources(c *Client, resources []*mcp.Resource, templates []*mcp.ResourceTemplate) {
+	m.resMu.Lock()
+	defer m.resMu.Unlock()
+
+	m.resources[c] = serverResources{resources: resources, templates: templates}
+	if m.instructions != nil {
+		m.instructions.SetInstructionSection(resourcesSection, m.resourceInstruction())
+	}
+	m.syncReadResourceTool()
+}
+
+// syncReadResourceTool registers read_resource while some server exposes
+// resources and removes it otherwise. It must be called with resMu held.
+func (m *Manager) syncReadResourceTool() {
+	if m.tools == nil {
+		return
+	}
+
+	exposed := false
+	for _, lists := range m.resources {
+		if len(lists.resources) > 0 || len(lists.templates) > 0 {
+			exposed = true
+			break
+		}
+	}
+
+	switch {
+	case exposed && !m.readResourceAdded:
+		if err := m.tools.SetFunctionCall(m.readResourceDeclaration()); err != nil {
+			log.Printf("mcp: register %s: %v", readResourceTool, err)
+			return
+		}
+		m.readResourceAdded = true
+	case !exposed && m.readResourceAdded:
+		m.tools.RemoveFunctionCall(readResourceTool)
+		m.readResourceAdded = false
+	}
+}
+
+func (m *Manager) readResourceDeclaration() *agent.FunctionDeclaration {
+	return &agent.FunctionDeclaration{
+		Name:        readResourceTool,
+		Description: "Read a resource (file, record, document...) exposed by a connected MCP server. The available resources and URI templates are listed in the system instruction.",
+		ParametersSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"uri": map[string]any{
+					"type":        "string",
+					"description": "URI of the resource, either listed or built from a URI template.",
+				},
+				"server": map[string]any{
+					"type":        "string",
+					"description": "Name of the server exposing the resource. Required when the URI comes from a template and several servers expose resources.",
+				},
+			},
+			"required": []string{"uri"},
+		},
+		FunctionCall: m.readResource,
+	}
+}
+
+// resourceInstruction must be called with resMu held.
+func (m *Manager) resourceInstruction() string {
+	var b strings.Builder
+	for _, c := range m.clients {
+		lists := m.resources[c]
+		if len(lists.resources) == 0 && len(lists.templates) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\nServer %q:\n", c.name)
+		for i, r := range lists.resources {
+			if i == maxListedResources {
+				fmt.Fprintf(&b, "- ... and %d more\n", len(lists.resources)-i)
+				break
+			}
+			fmt.Fprintf(&b, "- %s%s\n", r.URI, describeResource(r.Name, r.Title, r.Description, r.MIMEType))
+		}
+		for _, t := range lists.templates {
+			fmt.Fprintf(&b, "- template %s%s\n", t.URITemplate, describeResource(t.Name, t.Title, t.Description, t.MIMEType))
+		}
+	}
+
+	if b.Len() == 0 {
+		return ""
+	}
+	return "## MCP resources\nThe following resources can be read with the " + readResourceTool + " tool. Fill in URI templates before reading them.\n" + b.String()
+}
+
+func describeResource(name, title, description, mimeType string) string {
+	if title != "" {
+		name = title
+	}
+	s := " (" + name
+	if mimeType != "" {
+		s += ", " + mimeType
+	}
+	s += ")"
+	if description != "" {
+		s += ": " + description
+	}
+	return s
+}
+
+// readResource implements the read_resource tool.
+func (m *Manager) readResource(ctx context.Context, args map[string]any) (map[string]any, error) {
+	uri, _ := args["uri"].(string)
+	if uri == "" {
+		return nil, fmt.Errorf("%s: uri is required", readResourceTool)
+	}
+	server, _ := args["server"].(string)
+
+	c, err := m.resourceClient(server, uri)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", readResourceTool, err)
+	}
+
+	result, err := c.ReadResource(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([]map[string]any, 0, len(result.Contents))
+	for _, rc := range result.Contents {
+		contents = append(contents, resourceEntry(ctx, rc))
+	}
+	return map[string]any{"contents": contents}, nil
+}
+
+// resourceClient picks the server to read uri from: the named server, the
+// one that listed uri, or the only server exposing resources.
+func (m *Manager) resourceClient(server, uri string) (*Client, error) {
+	m.resMu.Lock()
+	defer m.resMu.Unlock()
+
+	if server != "" {
+		for _, c := range m.clients {
+			if c.name == server {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown server %q", server)
+	}
+
+	var candidates []*Client
+	for _, c := range m.clients {
+		lists := m.resources[c]
+		for _, r := range lists.resources {
+			if r.URI == uri {
+				return c, nil
+			}
+		}
+		if len(lists.resources) > 0 || len(lists.templates) > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no server exposes resource %q", uri)
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, fmt.Errorf("resource %q is not listed; set server to one of the servers exposing it", uri)
+	}
+}
@@ -0,0 +1,133 @@
+package mcp
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestInvalidate(t *testing.T) {
+	c := &Client{cache: map[string]*mcp.ReadResourceResult{
+		"file:///docs":         {},
+		"file:///docs/a.md":    {},
+		"file:///docs-archive": {},
+		"file:///doc":          {},
+		"db://tables/":         {},
+		"db://tables/users":    {},
+	}}
+
+	c.invalidate("file:///docs/a.md")
+	c.invalidate("db://tables/orders")
+
+	for _, uri := range []string{"file:///docs", "file:///docs/a.md", "db://tables/"} {
+		if _, ok := c.cache[uri]; ok {
+			t.Errorf("%s is still cached", uri)
+		}
+	}
+	for _, uri := range []string{"file:///docs-archive", "file:///doc", "db://tables/users"} {
+		if _, ok := c.cache[uri]; !ok {
+			t.Errorf("%s was evicted", uri)
+		}
+	}
+}
+
+// fakeRegistry records the tools registered with it.
+type fakeRegistry map[string]*agent.FunctionDeclaration
+
+func (r fakeRegistry) AddFunctionCall(fd *agent.FunctionDeclaration) error {
+	r[fd.Name] = fd
+	return nil
+}
+
+func (r fakeRegistry) SetFunctionCall(fd *agent.FunctionDeclaration) error {
+	r[fd.Name] = fd
+	return nil
+}
+
+func (r fakeRegistry) RemoveFunctionCall(name string) { delete(r, name) }
+
+func TestReadResourceToolFollowsResources(t *testing.T) {
+	a, b := &Client{name: "a"}, &Client{name: "b"}
+	tools := fakeRegistry{}
+	m := &Manager{clients: []*Client{a, b}, tools: tools, resources: make(map[*Client]serverResources)}
+
+	m.setResources(a, nil, nil)
+	m.setResources(b, nil, nil)
+	if _, ok := tools[readResourceTool]; ok {
+		t.Fatal("read_resource registered while no server exposes resources")
+	}
+
+	m.setResources(b, nil, []*mcp.ResourceTemplate{{URITemplate: "db://tables/{name}"}})
+	if _, ok := tools[readResourceTool]; !ok {
+		t.Fatal("read_resource not registered once a server exposes templates")
+	}
+
+	m.setResources(a, []*mcp.Resource{{URI: "file:///docs"}}, nil)
+	m.setResources(b, nil, nil)
+	if _, ok := tools[readResourceTool]; !ok {
+		t.Fatal("read_resource removed while a server still exposes resources")
+	}
+
+	m.setResources(a, nil, nil)
+	if _, ok := tools[readResourceTool]; ok {
+		t.Fatal("read_resource still registered after every server stopped exposing resources")
+	}
+}
+
+// subscribableServer exposes file:///notes, whose content names the
+// user_token it was read with, and counts the reads.
+func subscribableServer(reads *atomic.Int32) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1.0.0"}, &mcp.ServerOptions{
+		SubscribeHandler:   func(context.Context, *mcp.SubscribeRequest) error { return nil },
+		UnsubscribeHandler: func(context.Context, *mcp.UnsubscribeRequest) error { return nil },
+	})
+	server.AddResource(&mcp.Resource{URI: "file:///notes", Name: "notes"}, func(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		reads.Add(1)
+		user, _ := req.Params.Meta["user_token"].(string)
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: "file:///notes", Text: "notes of " + user}}}, nil
+	})
+	return server
+}
+
+func TestReadResourceCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		forward    bool
+		wantReads  int32
+		wantSecond string
+		wantCached bool
+	}{
+		{"shared identity", false, 1, "notes of ", true},
+		{"forwarded user token", true, 2, "notes of bob", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reads atomic.Int32
+			c, _ := connectInMemory(t, ServerConfig{ForwardUserToken: tt.forward}, subscribableServer(&reads))
+
+			if _, err := c.ReadResource(agent.WithUserToken(context.Background(), "alice"), "file:///notes"); err != nil {
+				t.Fatal(err)
+			}
+			res, err := c.ReadResource(agent.WithUserToken(context.Background(), "bob"), "file:///notes")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := res.Contents[0].Text; got != tt.wantSecond {
+				t.Errorf("second read = %q, want %q", got, tt.wantSecond)
+			}
+			if got := reads.Load(); got != tt.wantReads {
+				t.Errorf("server reads = %d, want %d", got, tt.wantReads)
+			}
+			c.cacheMu.Lock()
+			_, cached := c.cache["file:///notes"]
+			c.cacheMu.Unlock()
+			if cached != tt.wantCached {
+				t.Errorf("cached = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ErrSamplingRejected is returned to a server whose sampling request was
+// refused by the approval hook or its rate limit.
+var ErrSamplingRejected = errors.New("sampling request rejected")
+
+// SamplingApprover decides whether a server's sampling request may run.
+// Returning an error rejects the request with that reason.
+type SamplingApprover func(ctx context.Context, server string, params *mcp.CreateMessageParams) error
+
+// Sampler answers sampling/createMessage requests with the agent's provider.
+type Sampler struct {
+	Provider agent.LLMProvider
+
+	// DefaultModel is reported to servers that do not have a pinned model.
+	DefaultModel string
+
+	// Approve, if set, is consulted before every request.
+	Approve SamplingApprover
+}
+
+// SetSampler enables sampling for every server whose configuration has a
+// sampling section. Requests received before it is called are rejected.
+func (m *Manager) SetSampler(s *Sampler) {
+	for _, c := range m.clients {
+		c.mu.Lock()
+		c.sampler = s
+		c.mu.Unlock()
+	}
+}
+
+// createMessage handles sampling/createMessage for servers with sampling
+// enabled in their configuration.
+func (c *Client) createMessage(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	c.mu.RLock()
+	sampler := c.sampler
+	c.mu.RUnlock()
+	if sampler == nil || sampler.Provider == nil {
+		return nil, fmt.Errorf("%w: sampling is not available", ErrSamplingRejected)
+	}
+
+	limits := c.cfg.Sampling
+	if !c.samplingLimiter.allow() {
+		log.Printf("mcp: server %q: sampling rate limit exceeded", c.name)
+		return nil, fmt.Errorf("%w: rate limit of %d requests per minute exceeded", ErrSamplingRejected, limits.RequestsPerMinute)
+	}
+
+	params := req.Params
+	if sampler.Approve != nil {
+		if err := sampler.Approve(ctx, c.name, params); err != nil {
+			log.Printf("mcp: server %q: sampling request rejected: %v", c.name, err)
+			return nil, fmt.Errorf("%w: %v", ErrSamplingRejected, err)
+		}
+	}
+
+	history, prompt, err := samplingHistory(params.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	maxTokens := int(params.MaxTokens)
+	if limits.MaxTokens > 0 && (maxTokens <= 0 || maxTokens > limits.MaxTokens) {
+		maxTokens = limits.MaxTokens
+	}
+
+	modelName := sampler.DefaultModel
+	if limits.Model != "" {
+		modelName = limits.Model
+	}
+
+	contents, err := sampler.Provider.Send(ctx, agent.ProviderRequest{
+		SystemInstruction: params.SystemPrompt,
+		History:           history,
+		Prompt:            prompt,
+		Model:             limits.Model,
+		MaxTokens:         maxTokens,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sampling: %w", err)
+	}
+
+	return &mcp.CreateMessageResult{
+		Content:    &mcp.TextContent{Text: lastModelText(contents)},
+		Model:      modelName,
+		Role:       "assistant",
+		StopReason: "endTurn",
+	}, nil
+}
+
+// samplingHistory converts sampling messages into provider history. The
+// final message must be user text; it becomes the prompt.
+func samplingHistory(messages []*mcp.SamplingMessage) ([]model.Content, string, error) {
+	if len(messages) == 0 {
+		return nil, "", errors.New("sampling: no messages")
+	}
+
+	last := messages[len(messages)-1]
+	text, ok := last.Content.(*mcp.TextContent)
+	if last.Role != "user" || !ok {
+		return nil, "", errors.New("sampling: the last message must be user text")
+	}
+
+	history := make([]model.Content, 0, len(messages)-1)
+	for _, msg := range messages[:len(messages)-1] {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+
+		var part model.Part
+		switch c := msg.Content.(type) {
+		case *mcp.TextContent:
+			part.Text = c.Text
+		case *mcp.ImageContent:
+			part.InlineData = &model.InlineData{MIMEType: c.MIMEType, Data: c.Data}
+		case *mcp.AudioContent:
+			part.InlineData = &model.InlineData{MIMEType: c.MIMEType, Data: c.Data}
+		default:
+			return nil, "", fmt.Errorf("sampling: unsupported %T content", msg.Content)
+		}
+		history = append(history, model.Content{Role: role, Parts: []model.Part{part}})
+	}
+
+	return history, text.Text, nil
+}
+
+// lastModelText returns the text of the final model turn.
+func lastModelText(contents []model.Content) string {
+	for i := len(contents) - 1; i >= 0; i-- {
+		if contents[i].Role != "model" {
+			continue
+		}
+		var parts []string
+		for _, p := range contents[i].Parts {
+			if p.Text != "" {
+				parts = append(parts, p.Text)
+			}
+		}
+		return strings.Join(parts, "")
+	}
+	return ""
+}
+
+// rateLimiter allows at most limit events in any one-minute window. A nil
+// limiter or a zero limit allows everything.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	events []time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{limit: perMinute}
+}
+
+func (l *rateLimiter) allow() bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(l.events) && l.events[i].Before(cutoff) {
+		i++
+	}
+	l.events = l.events[i:]
+
+	if len(l.events) >= l.limit {
+		return false
+	}
+	l.events = append(l.events, now)
+	return true
+}
@@ -0,0 +1,165 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectInMemory connects a client configured by cfg to server over an
+// in-memory transport and returns both ends of the session.
+func connectInMemory(t *testing.T, cfg ServerConfig, server *mcp.Server) (*Client, *mcp.ServerSession) {
+	t.Helper()
+	ctx := context.Background()
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(cfg)
+	session, err := c.client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.setSession(session)
+	t.Cleanup(c.Close)
+	return c, ss
+}
+
+func newTestServer() *mcp.Server {
+	return mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+}
+
+// fakeProvider answers with a fixed text and records the requests it got.
+type fakeProvider struct {
+	mu   sync.Mutex
+	reqs []agent.ProviderRequest
+}
+
+func (p *fakeProvider) Send(_ context.Context, req agent.ProviderRequest) ([]model.Content, error) {
+	p.mu.Lock()
+	p.reqs = append(p.reqs, req)
+	p.mu.Unlock()
+	return []model.Content{
+		{Role: "model", Parts: []model.Part{{Text: "thinking"}}},
+		{Role: "model", Parts: []model.Part{{Text: "Paris"}}},
+	}, nil
+}
+
+func (p *fakeProvider) SendStream(ctx context.Context, req agent.ProviderRequest, _ func(string) error, _ func(string, map[string]any) error, _ func() error) ([]model.Content, error) {
+	return p.Send(ctx, req)
+}
+
+func samplingParams(prompt string) *mcp.CreateMessageParams {
+	return &mcp.CreateMessageParams{
+		SystemPrompt: "Answer briefly.",
+		MaxTokens:    4096,
+		Messages: []*mcp.SamplingMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: "Hi"}},
+			{Role: "assistant", Content: &mcp.TextContent{Text: "Hello"}},
+			{Role: "user", Content: &mcp.TextContent{Text: prompt}},
+		},
+	}
+}
+
+func TestSampling(t *testing.T) {
+	provider := &fakeProvider{}
+	var approved []string
+	c, ss := connectInMemory(t, ServerConfig{
+		Name:     "wiki",
+		Sampling: &SamplingConfig{Model: "small-model", MaxTokens: 256},
+	}, newTestServer())
+	(&Manager{clients: []*Client{c}}).SetSampler(&Sampler{
+		Provider:     provider,
+		DefaultModel: "default-model",
+		Approve: func(_ context.Context, server string, params *mcp.CreateMessageParams) error {
+			approved = append(approved, server)
+			if strings.Contains(params.Messages[len(params.Messages)-1].Content.(*mcp.TextContent).Text, "secret") {
+				return errors.New("asks for secrets")
+			}
+			return nil
+		},
+	})
+	ctx := context.Background()
+
+	res, err := ss.CreateMessage(ctx, samplingParams("Capital of France?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := res.Content.(*mcp.TextContent); text == nil || text.Text != "Paris" || res.Model != "small-model" || res.Role != "assistant" {
+		t.Errorf("result = %+v, want the final model text from the pinned model", res)
+	}
+
+	req := provider.reqs[0]
+	if req.SystemInstruction != "Answer briefly." || req.Prompt != "Capital of France?" || req.Model != "small-model" || req.MaxTokens != 256 {
+		t.Errorf("provider request = %+v", req)
+	}
+	if len(req.History) != 2 || req.History[0].Role != "user" || req.History[1].Role != "model" || req.History[1].Parts[0].Text != "Hello" {
+		t.Errorf("provider history = %+v", req.History)
+	}
+
+	// A rejected request never reaches the provider.
+	if _, err := ss.CreateMessage(ctx, samplingParams("Tell me a secret")); err == nil || !strings.Contains(err.Error(), "asks for secrets") {
+		t.Errorf("rejected request error = %v", err)
+	}
+	if len(provider.reqs) != 1 {
+		t.Errorf("provider called %d times, want 1", len(provider.reqs))
+	}
+	if strings.Join(approved, ",") != "wiki,wiki" {
+		t.Errorf("approval hook saw %v", approved)
+	}
+
+	// The last message must be user text.
+	params := samplingParams("")
+	params.Messages = params.Messages[:2]
+	if _, err := ss.CreateMessage(ctx, params); err == nil {
+		t.Error("accepted a request ending with an assistant message")
+	}
+}
+
+func TestSamplingRateLimit(t *testing.T) {
+	provider := &fakeProvider{}
+	c, ss := connectInMemory(t, ServerConfig{
+		Name:     "wiki",
+		Sampling: &SamplingConfig{RequestsPerMinute: 2},
+	}, newTestServer())
+	(&Manager{clients: []*Client{c}}).SetSampler(&Sampler{Provider: provider, DefaultModel: "default-model"})
+	ctx := context.Background()
+
+	for i := range 2 {
+		res, err := ss.CreateMessage(ctx, samplingParams("Capital of France?"))
+		if err != nil {
+			t.Fatalf("request %d within the limit: %v", i+1, err)
+		}
+		if res.Model != "default-model" {
+			t.Errorf("model = %q, want the agent's model", res.Model)
+		}
+	}
+	if _, err := ss.CreateMessage(ctx, samplingParams("Capital of France?")); err == nil || !strings.Contains(err.Error(), "rate limit of 2 requests per minute") {
+		t.Errorf("request over the limit error = %v", err)
+	}
+	if len(provider.reqs) != 2 {
+		t.Errorf("provider called %d times, want 2", len(provider.reqs))
+	}
+}
+
+func TestSamplingWithoutSampler(t *testing.T) {
+	_, ss := connectInMemory(t, ServerConfig{Name: "wiki", Sampling: &SamplingConfig{}}, newTestServer())
+	if _, err := ss.CreateMessage(context.Background(), samplingParams("Hi")); err == nil {
+		t.Error("sampling answered before a sampler was set")
+	}
+
+	// Servers without a sampling section are not offered the capability.
+	_, ss = connectInMemory(t, ServerConfig{Name: "docs"}, newTestServer())
+	if ss.InitializeParams().Capabilities.Sampling != nil {
+		t.Error("sampling capability advertised to a server without a sampling section")
+	}
+}
@@ -0,0 +1,127 @@
+package mcp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"golang.org/x/oauth2"
+)
+
+// stdioTerminateTimeout is how long Close waits for a stdio server to exit
+// after its stdin is closed before the process is signalled.
+const stdioTerminateTimeout = 2 * time.Second
+
+// transportType resolves the effective transport, inferring stdio for
+// command-based entries that do not set one.
+func (s ServerConfig) transportType() TransportType {
+	if s.Transport == "" && s.URL == "" && s.Command != "" {
+		return TransportStdio
+	}
+	return s.Transport
+}
+
+// newTransport builds a fresh transport for cfg, authenticating HTTP
+// requests with oauth when it is set. For stdio servers every call
+// prepares a new process, so it can also be used to restart a crashed server.
+func newTransport(cfg ServerConfig, oauth *oauthClient) (mcp.Transport, error) {
+	switch cfg.transportType() {
+	case TransportStdio:
+		return newCommandTransport(cfg)
+	case TransportSSE:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("mcp: endpoint must be set")
+		}
+		return &mcp.SSEClientTransport{Endpoint: cfg.URL, HTTPClient: newHTTPClient(cfg, oauth)}, nil
+	case TransportStreamable, "":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("mcp: endpoint must be set")
+		}
+		return &mcp.StreamableClientTransport{Endpoint: cfg.URL, HTTPClient: newHTTPClient(cfg, oauth)}, nil
+	default:
+		return nil, fmt.Errorf("mcp: server %q: unknown transport %q", cfg.Name, cfg.Transport)
+	}
+}
+
+func newCommandTransport(cfg ServerConfig) (mcp.Transport, error) {
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("mcp: server %q: command must be set for stdio transport", cfg.Name)
+	}
+
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = &stderrLogger{prefix: fmt.Sprintf("mcp[%s]: ", cfg.Name)}
+
+	return &mcp.CommandTransport{Command: cmd, TerminateDuration: stdioTerminateTimeout}, nil
+}
+
+// newHTTPClient returns a client sending the configured headers and
+// credentials, or nil when the server needs neither.
+func newHTTPClient(cfg ServerConfig, oauth *oauthClient) *http.Client {
+	headers := cfg.Headers
+	if cfg.Auth != nil && cfg.Auth.Type == AuthBearer {
+		headers = make(map[string]string, len(cfg.Headers)+1)
+		for k, v := range cfg.Headers {
+			headers[k] = v
+		}
+		headers["Authorization"] = "Bearer " + cfg.Auth.Token
+	}
+
+	var rt http.RoundTripper = http.DefaultTransport
+	if len(headers) > 0 {
+		rt = &headerTransport{headers: headers, base: rt}
+	}
+	if oauth != nil {
+		rt = &oauth2.Transport{Source: oauth, Base: rt}
+	}
+	if rt == http.DefaultTransport {
+		return nil
+	}
+	return &http.Client{Transport: rt}
+}
+
+// headerTransport adds static headers to every outgoing request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// stderrLogger forwards a server process's stderr to the log, one line at a time.
+type stderrLogger struct {
+	prefix string
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func (l *stderrLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Printf("%s%s", l.prefix, bytes.TrimRight(l.buf[:i], "\r"))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,277 @@
+// Package mcpserver exposes the agent itself as an MCP server, so other
+// agents and IDE clients can chat with it and use its knowledge base.
+package mcpserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/auth"
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/m2tx/agent_example/internal/vectorstore"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// chatTool is the name of the tool that sends a prompt to the agent.
+	chatTool = "chat"
+
+	// docsScheme prefixes the URIs of documents exposed as resources.
+	docsScheme = "docs://"
+
+	// PrincipalKey is the TokenInfo.Extra entry holding the *auth.Principal
+	// of the caller, set by the HTTP middleware guarding the endpoint.
+	PrincipalKey = "principal"
+
+	instructions = "Use the chat tool to ask the agent questions; pass the returned session_id back to continue the conversation. Indexed documents can be read as docs:// resources."
+)
+
+// Chatter runs a conversation turn. It is implemented by *agent.Agent.
+type Chatter interface {
+	Send(ctx context.Context, sessionID string, prompt string) ([]model.Content, error)
+}
+
+// Documents lists and reads indexed documents. It is implemented by
+// *agent.Embedder.
+type Documents interface {
+	Documents(ctx context.Context) ([]vectorstore.DocumentInfo, error)
+	Document(ctx context.Context, documentID string) ([]agent.EmbeddedDocument, error)
+}
+
+// Server publishes the agent over MCP: a chat tool backed by the agent, the
+// given local tools, and the indexed documents as resources.
+type Server struct {
+	server *mcp.Server
+	chat   Chatter
+	docs   Documents
+
+	// stdioSession is the default conversation of the stdio client, which
+	// has no MCP session ID.
+	stdioSession string
+
+	mu   sync.Mutex
+	uris []string
+}
+
+type chatInput struct {
+	Prompt    string `json:"prompt" jsonschema:"the message to send to the agent"`
+	SessionID string `json:"session_id,omitempty" jsonschema:"conversation to continue; defaults to one conversation per MCP session"`
+}
+
+type chatOutput struct {
+	Answer    string           `json:"answer"`
+	SessionID string           `json:"session_id"`
+	Citations []model.Citation `json:"citations,omitempty"`
+}
+
+// New creates a server exposing chat and, re-exported as MCP tools, the
+// given function declarations. docs may be nil to publish no resources.
+func New(chat Chatter, docs Documents, tools ...*agent.FunctionDeclaration) *Server {
+	s := &Server{
+		server: mcp.NewServer(&mcp.Implementation{Name: "agent_example", Version: "1.0.0"}, &mcp.ServerOptions{
+			Instructions: instructions,
+		}),
+		chat:         chat,
+		docs:         docs,
+		stdioSession: "mcp-" + newSessionID(),
+	}
+
+	mcp.AddTool(s.server, &mcp.Tool{
+		Name:        chatTool,
+		Description: "Ask the company assistant a question. It can search internal documentation, look up companies and collaborators, and keeps the conversation history of the session.",
+	}, s.handleChat)
+
+	for _, decl := range tools {
+		s.server.AddTool(&mcp.Tool{
+			Name:        decl.Name,
+			Description: decl.Description,
+			InputSchema: decl.ParametersSchema,
+		}, toolHandler(decl))
+	}
+
+	if docs != nil {
+		s.server.AddResourceTemplate(&mcp.ResourceTemplate{
+			Name:        "document",
+			Description: "An indexed document, as extracted text.",
+			URITemplate: docsScheme + "{id}",
+			MIMEType:    "text/plain",
+		}, s.readDocument)
+	}
+
+	return s
+}
+
+// Handler returns the streamable HTTP handler serving the MCP endpoint.
+func (s *Server) Handler() http.Handler {
+	return mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return s.server }, nil)
+}
+
+// RunStdio serves a single client over stdin/stdout until it disconnects or
+// ctx is done.
+func (s *Server) RunStdio(ctx context.Context) error {
+	return s.server.Run(ctx, &mcp.StdioTransport{})
+}
+
+// SyncDocuments publishes the current list of indexed documents as
+// resources. Clients are notified with notifications/resources/list_changed.
+func (s *Server) SyncDocuments(ctx context.Context) error {
+	if s.docs == nil {
+		return nil
+	}
+
+	infos, err := s.docs.Documents(ctx)
+	if err != nil {
+		return fmt.Errorf("mcpserver: list documents: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uris := make([]string, 0, len(infos))
+	for _, info := range infos {
+		uri := docsScheme + url.PathEscape(info.ID)
+		uris = append(uris, uri)
+		s.server.AddResource(&mcp.Resource{
+			URI:      uri,
+			Name:     info.Filename,
+			MIMEType: "text/plain",
+		}, s.readDocument)
+	}
+
+	var removed []string
+	for _, uri := range s.uris {
+		if !slices.Contains(uris, uri) {
+			removed = append(removed, uri)
+		}
+	}
+	if len(removed) > 0 {
+		s.server.RemoveResources(removed...)
+	}
+	s.uris = uris
+	return nil
+}
+
+// handleChat sends the prompt to the agent. Without a session_id, every MCP
+// session gets its own conversation.
+func (s *Server) handleChat(ctx context.Context, req *mcp.CallToolRequest, in chatInput) (*mcp.CallToolResult, chatOutput, error) {
+	if in.Prompt == "" {
+		return nil, chatOutput{}, fmt.Errorf("prompt is required")
+	}
+
+	sessionID := in.SessionID
+	if sessionID == "" {
+		sessionID = "mcp-" + req.Session.ID()
+		if req.Session.ID() == "" {
+			sessionID = s.stdioSession
+		}
+	}
+
+	contents, err := s.chat.Send(withPrincipal(ctx, req.Extra), sessionID, in.Prompt)
+	if err != nil {
+		return nil, chatOutput{}, err
+	}
+
+	out := chatOutput{SessionID: sessionID}
+	var answer []string
+	for _, c := range contents {
+		for _, p := range c.Parts {
+			if p.Text != "" {
+				answer = append(answer, p.Text)
+			}
+		}
+		out.Citations = append(out.Citations, c.Citations...)
+	}
+	out.Answer = strings.Join(answer, "")
+
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: out.Answer}}}, out, nil
+}
+
+// toolHandler calls a local function declaration. Failures are reported as
+// tool errors so the calling model can see them.
+func toolHandler(decl *agent.FunctionDeclaration) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := map[string]any{}
+		if len(req.Params.Arguments) > 0 {
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil {
+				return toolError(fmt.Errorf("%s: invalid arguments: %w", decl.Name, err)), nil
+			}
+		}
+
+		response, err := decl.FunctionCall(withPrincipal(ctx, req.Extra), args)
+		if err != nil {
+			return toolError(err), nil
+		}
+
+		data, err := json.Marshal(response)
+		if err != nil {
+			return toolError(fmt.Errorf("%s: encode response: %w", decl.Name, err)), nil
+		}
+		return &mcp.CallToolResult{
+			Content:           []mcp.Content{&mcp.TextContent{Text: string(data)}},
+			StructuredContent: response,
+		}, nil
+	}
+}
+
+// withPrincipal puts the authenticated caller of an HTTP request on ctx, so
+// the agent binds sessions to them and tools see who is calling.
+func withPrincipal(ctx context.Context, extra *mcp.RequestExtra) context.Context {
+	if extra == nil || extra.TokenInfo == nil {
+		return ctx
+	}
+	if p, ok := extra.TokenInfo.Extra[PrincipalKey].(*auth.Principal); ok {
+		return auth.WithPrincipal(ctx, p)
+	}
+	return ctx
+}
+
+func toolError(err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		IsError: true,
+	}
+}
+
+// readDocument returns a document's chunks, in order, as one text.
+func (s *Server) readDocument(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	id, err := url.PathUnescape(strings.TrimPrefix(uri, docsScheme))
+	if err != nil || !strings.HasPrefix(uri, docsScheme) {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+
+	chunks, err := s.docs.Document(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("mcpserver: read document %q: %w", id, err)
+	}
+	if len(chunks) == 0 {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+
+	slices.SortFunc(chunks, func(a, b agent.EmbeddedDocument) int { return a.Chunk - b.Chunk })
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Text
+	}
+
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{
+		URI:      uri,
+		MIMEType: "text/plain",
+		Text:     strings.Join(texts, "\n\n"),
+	}}}, nil
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
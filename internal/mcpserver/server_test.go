@@ -0,0 +1,210 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+	"github.com/m2tx/agent_example/internal/vectorstore"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// fakeChatter answers every prompt with two text parts and a citation, and
+// records the sessions it was called with.
+type fakeChatter struct {
+	mu       sync.Mutex
+	sessions []string
+}
+
+func (f *fakeChatter) Send(_ context.Context, sessionID string, prompt string) ([]model.Content, error) {
+	f.mu.Lock()
+	f.sessions = append(f.sessions, sessionID)
+	f.mu.Unlock()
+	return []model.Content{{
+		Role:      "model",
+		Parts:     []model.Part{{Text: "You said: "}, {Text: prompt}},
+		Citations: []model.Citation{{Index: 1, DocumentID: "d1", Filename: "vacation.md"}},
+	}}, nil
+}
+
+// fakeDocuments holds documents as chunks keyed by document ID.
+type fakeDocuments map[string][]agent.EmbeddedDocument
+
+func (f fakeDocuments) Documents(context.Context) ([]vectorstore.DocumentInfo, error) {
+	var infos []vectorstore.DocumentInfo
+	for id, chunks := range f {
+		infos = append(infos, vectorstore.DocumentInfo{ID: id, Filename: chunks[0].Filename, Chunks: len(chunks)})
+	}
+	return infos, nil
+}
+
+func (f fakeDocuments) Document(_ context.Context, documentID string) ([]agent.EmbeddedDocument, error) {
+	return f[documentID], nil
+}
+
+// connect starts a client session with s over an in-memory transport.
+func connect(t *testing.T, s *Server) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := s.server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func chat(t *testing.T, session *mcp.ClientSession, args map[string]any) chatOutput {
+	t.Helper()
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: chatTool, Arguments: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IsError {
+		t.Fatalf("chat %v failed: %s", args, res.Content[0].(*mcp.TextContent).Text)
+	}
+	data, err := json.Marshal(res.StructuredContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out chatOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestChat(t *testing.T) {
+	chatter := &fakeChatter{}
+	session := connect(t, New(chatter, nil))
+
+	first := chat(t, session, map[string]any{"prompt": "hi"})
+	if first.Answer != "You said: hi" || len(first.Citations) != 1 || first.Citations[0].Filename != "vacation.md" {
+		t.Errorf("chat = %+v", first)
+	}
+	if !strings.HasPrefix(first.SessionID, "mcp-") {
+		t.Errorf("session_id = %q, want one derived from the MCP session", first.SessionID)
+	}
+
+	// The MCP session keeps its conversation, unless the caller picks one.
+	if second := chat(t, session, map[string]any{"prompt": "again"}); second.SessionID != first.SessionID {
+		t.Errorf("second turn session_id = %q, want %q", second.SessionID, first.SessionID)
+	}
+	if other := chat(t, session, map[string]any{"prompt": "hi", "session_id": "s1"}); other.SessionID != "s1" {
+		t.Errorf("session_id = %q, want s1", other.SessionID)
+	}
+	if want := []string{first.SessionID, first.SessionID, "s1"}; strings.Join(chatter.sessions, ",") != strings.Join(want, ",") {
+		t.Errorf("agent sessions = %v, want %v", chatter.sessions, want)
+	}
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: chatTool, Arguments: map[string]any{"prompt": ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError {
+		t.Error("chat accepted an empty prompt")
+	}
+}
+
+func TestLocalTools(t *testing.T) {
+	tools := []*agent.FunctionDeclaration{
+		{
+			Name:             "get_weather",
+			Description:      "Weather of a city.",
+			ParametersSchema: map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+			FunctionCall: func(_ context.Context, args map[string]any) (map[string]any, error) {
+				return map[string]any{"city": args["city"], "celsius": 21.0}, nil
+			},
+		},
+		{
+			Name:             "broken",
+			ParametersSchema: map[string]any{"type": "object"},
+			FunctionCall: func(context.Context, map[string]any) (map[string]any, error) {
+				return nil, errors.New("backend down")
+			},
+		},
+	}
+	session := connect(t, New(&fakeChatter{}, nil, tools...))
+	ctx := context.Background()
+
+	listed, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range listed.Tools {
+		names = append(names, tool.Name)
+	}
+	if strings.Join(names, ",") != "broken,chat,get_weather" {
+		t.Errorf("tools = %v", names)
+	}
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "get_weather", Arguments: map[string]any{"city": "London"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := res.StructuredContent.(map[string]any)
+	if res.IsError || got["city"] != "London" || got["celsius"] != 21.0 {
+		t.Errorf("get_weather = %+v", res)
+	}
+
+	res, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "broken", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || res.Content[0].(*mcp.TextContent).Text != "backend down" {
+		t.Errorf("broken = %+v, want a tool error", res)
+	}
+}
+
+func TestDocumentResources(t *testing.T) {
+	docs := fakeDocuments{
+		"d1": {
+			{DocumentID: "d1", Filename: "vacation.md", Chunk: 1, Text: "second"},
+			{DocumentID: "d1", Filename: "vacation.md", Chunk: 0, Text: "first"},
+		},
+		"d2": {{DocumentID: "d2", Filename: "benefits.md", Text: "benefits"}},
+	}
+	s := New(&fakeChatter{}, docs)
+	ctx := context.Background()
+	if err := s.SyncDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	session := connect(t, s)
+
+	res, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "docs://d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := res.Contents[0].Text; text != "first\n\nsecond" {
+		t.Errorf("docs://d1 = %q, want the chunks in order", text)
+	}
+	if res, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "docs://d2"}); err != nil || res.Contents[0].Text != "benefits" {
+		t.Errorf("docs://d2 = %v, %v", res, err)
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "docs://missing"}); err == nil {
+		t.Error("read a missing document")
+	}
+
+	delete(docs, "d2")
+	if err := s.SyncDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := session.ListResources(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Resources) != 1 || listed.Resources[0].URI != "docs://d1" || listed.Resources[0].Name != "vacation.md" {
+		t.Errorf("resources after removing a document = %+v", listed.Resources)
+	}
+}
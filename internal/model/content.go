@@ -7,22 +7,47 @@ type FunctionCall struct {
 	Args map[string]any `json:"args,omitempty" bson:"args,omitempty"`
 }
 
-// FunctionResponse represents the result of a function invocation.
+// FunctionResponse represents the result of a function invocation. Parts
+// carries media (images, audio) returned alongside the JSON response.
 type FunctionResponse struct {
 	ID       string         `json:"id,omitempty" bson:"id,omitempty"`
 	Name     string         `json:"name" bson:"name"`
 	Response map[string]any `json:"response,omitempty" bson:"response,omitempty"`
+	Parts    []Part         `json:"parts,omitempty" bson:"parts,omitempty"`
+}
+
+// InlineData is binary content, such as an image or audio clip, embedded in
+// a conversation turn.
+type InlineData struct {
+	MIMEType string `json:"mime_type" bson:"mime_type"`
+	Data     []byte `json:"data" bson:"data"`
+	// URI identifies where the data came from, e.g. an MCP resource.
+	URI string `json:"uri,omitempty" bson:"uri,omitempty"`
+	// Ref identifies Data in the session store when it is saved apart from
+	// the turn; Data is empty while it is set.
+	Ref string `json:"-" bson:"ref,omitempty"`
 }
 
 // Part is a single piece of a conversation turn.
 type Part struct {
 	Text             string            `json:"text,omitempty" bson:"text,omitempty"`
+	InlineData       *InlineData       `json:"inline_data,omitempty" bson:"inline_data,omitempty"`
 	FunctionCall     *FunctionCall     `json:"function_call,omitempty" bson:"function_call,omitempty"`
 	FunctionResponse *FunctionResponse `json:"function_response,omitempty" bson:"function_response,omitempty"`
 }
 
+// Citation links an answer to a document chunk returned by search_docs.
+type Citation struct {
+	Index      int    `json:"index" bson:"index"`
+	DocumentID string `json:"document_id" bson:"document_id"`
+	Filename   string `json:"filename" bson:"filename"`
+	Location   string `json:"location,omitempty" bson:"location,omitempty"`
+	Snippet    string `json:"snippet,omitempty" bson:"snippet,omitempty"`
+}
+
 // Content is a single conversation turn, composed of one or more parts.
 type Content struct {
-	Parts []Part `json:"parts" bson:"parts"`
-	Role  string `json:"role" bson:"role"`
+	Parts     []Part     `json:"parts" bson:"parts"`
+	Role      string     `json:"role" bson:"role"`
+	Citations []Citation `json:"citations,omitempty" bson:"citations,omitempty"`
 }
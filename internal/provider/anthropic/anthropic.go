@@ -2,6 +2,7 @@ package anthropic
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 
@@ -25,6 +26,30 @@ func New(apiKey string, modelName string) *Provider {
 	}
 }
 
+// defaultMaxTokens caps responses when the request does not set MaxTokens.
+const defaultMaxTokens = 8192
+
+// params builds the request for one model call of a turn.
+func (p *Provider) params(req agent.ProviderRequest, tools []anthropic.ToolUnionParam, messages []anthropic.MessageParam) anthropic.MessageNewParams {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(p.modelName),
+		MaxTokens: defaultMaxTokens,
+		Tools:     tools,
+		Messages:  messages,
+	}
+	if req.Model != "" {
+		params.Model = anthropic.Model(req.Model)
+	}
+	if req.MaxTokens > 0 {
+		params.MaxTokens = int64(req.MaxTokens)
+	}
+	// The API rejects empty text blocks.
+	if req.SystemInstruction != "" {
+		params.System = []anthropic.TextBlockParam{{Text: req.SystemInstruction}}
+	}
+	return params
+}
+
 func (p *Provider) Send(ctx context.Context, req agent.ProviderRequest) ([]model.Content, error) {
 	messages := historyToMessages(req.History)
 	tools := buildTools(req.Tools)
@@ -39,18 +64,11 @@ func (p *Provider) Send(ctx context.Context, req agent.ProviderRequest) ([]model
 	})
 
 	for {
-		resp, err := p.client.Messages.New(ctx, anthropic.MessageNewParams{
-			Model:     anthropic.Model(p.modelName),
-			MaxTokens: 8192,
-			System: []anthropic.TextBlockParam{
-				{Text: req.SystemInstruction},
-			},
-			Tools:    tools,
-			Messages: messages,
-		})
+		resp, err := p.client.Messages.New(ctx, p.params(req, tools, messages))
 		if err != nil {
 			return nil, err
 		}
+		recordUsage(ctx, resp)
 
 		modelContent := responseToModelContent(resp)
 		newContents = append(newContents, modelContent)
@@ -82,15 +100,7 @@ func (p *Provider) SendStream(ctx context.Context, req agent.ProviderRequest, on
 	})
 
 	for {
-		stream := p.client.Messages.NewStreaming(ctx, anthropic.MessageNewParams{
-			Model:     anthropic.Model(p.modelName),
-			MaxTokens: 8192,
-			System: []anthropic.TextBlockParam{
-				{Text: req.SystemInstruction},
-			},
-			Tools:    tools,
-			Messages: messages,
-		})
+		stream := p.client.Messages.NewStreaming(ctx, p.params(req, tools, messages))
 
 		acc := anthropic.Message{}
 		for stream.Next() {
@@ -110,6 +120,7 @@ func (p *Provider) SendStream(ctx context.Context, req agent.ProviderRequest, on
 		if err := stream.Err(); err != nil {
 			return nil, err
 		}
+		recordUsage(ctx, &acc)
 
 		// notify about any function calls
 		if onFunctionCall != nil {
@@ -148,6 +159,16 @@ func (p *Provider) SendStream(ctx context.Context, req agent.ProviderRequest, on
 	return newContents, nil
 }
 
+// recordUsage reports the tokens billed for resp. Cache writes and reads are
+// counted as input.
+func recordUsage(ctx context.Context, resp *anthropic.Message) {
+	agent.RecordUsage(ctx, agent.Usage{
+		Model:        string(resp.Model),
+		InputTokens:  resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+	})
+}
+
 // historyToMessages converts stored model.Content history to Anthropic MessageParam slice.
 // Role "model" is mapped to "assistant"; "user" is kept as-is.
 func historyToMessages(history []model.Content) []anthropic.MessageParam {
@@ -180,7 +201,13 @@ func partsToContentBlocks(parts []model.Part) []anthropic.ContentBlockParamUnion
 			blocks = append(blocks, anthropic.NewToolUseBlock(p.FunctionCall.ID, json.RawMessage(inputJSON), p.FunctionCall.Name))
 		case p.FunctionResponse != nil:
 			respJSON, _ := json.Marshal(p.FunctionResponse.Response)
-			blocks = append(blocks, anthropic.NewToolResultBlock(p.FunctionResponse.ID, string(respJSON), false))
+			blocks = append(blocks, toolResultBlock(p.FunctionResponse.ID, string(respJSON), p.FunctionResponse.Parts, false))
+		case p.InlineData != nil:
+			if isSupportedImage(p.InlineData.MIMEType) {
+				blocks = append(blocks, anthropic.NewImageBlockBase64(p.InlineData.MIMEType, base64.StdEncoding.EncodeToString(p.InlineData.Data)))
+			} else {
+				blocks = append(blocks, anthropic.NewTextBlock(omittedMedia(p.InlineData)))
+			}
 		case p.Text != "":
 			blocks = append(blocks, anthropic.NewTextBlock(p.Text))
 		}
@@ -188,6 +215,53 @@ func partsToContentBlocks(parts []model.Part) []anthropic.ContentBlockParamUnion
 	return blocks
 }
 
+// toolResultBlock builds a tool_result carrying the JSON response followed by
+// any media the tool returned. Claude accepts images in tool results; other
+// media types are described in text instead.
+func toolResultBlock(toolUseID string, content string, parts []model.Part, isError bool) anthropic.ContentBlockParamUnion {
+	block := anthropic.NewToolResultBlock(toolUseID, content, isError)
+	for _, p := range parts {
+		if p.InlineData == nil {
+			continue
+		}
+		if isSupportedImage(p.InlineData.MIMEType) {
+			block.OfToolResult.Content = append(block.OfToolResult.Content, anthropic.ToolResultBlockParamContentUnion{
+				OfImage: &anthropic.ImageBlockParam{
+					Source: anthropic.ImageBlockParamSourceUnion{
+						OfBase64: &anthropic.Base64ImageSourceParam{
+							Data:      base64.StdEncoding.EncodeToString(p.InlineData.Data),
+							MediaType: anthropic.Base64ImageSourceMediaType(p.InlineData.MIMEType),
+						},
+					},
+				},
+			})
+			continue
+		}
+		block.OfToolResult.Content = append(block.OfToolResult.Content, anthropic.ToolResultBlockParamContentUnion{
+			OfText: &anthropic.TextBlockParam{Text: omittedMedia(p.InlineData)},
+		})
+	}
+	return block
+}
+
+func isSupportedImage(mimeType string) bool {
+	switch anthropic.Base64ImageSourceMediaType(mimeType) {
+	case anthropic.Base64ImageSourceMediaTypeImageJPEG,
+		anthropic.Base64ImageSourceMediaTypeImagePNG,
+		anthropic.Base64ImageSourceMediaTypeImageGIF,
+		anthropic.Base64ImageSourceMediaTypeImageWebP:
+		return true
+	}
+	return false
+}
+
+func omittedMedia(d *model.InlineData) string {
+	if d.URI != "" {
+		return fmt.Sprintf("[%s content from %s (%d bytes) is not supported by this model]", d.MIMEType, d.URI, len(d.Data))
+	}
+	return fmt.Sprintf("[%s content (%d bytes) is not supported by this model]", d.MIMEType, len(d.Data))
+}
+
 func buildTools(fns map[string]*agent.FunctionDeclaration) []anthropic.ToolUnionParam {
 	tools := make([]anthropic.ToolUnionParam, 0, len(fns))
 	for _, fd := range fns {
@@ -267,7 +341,7 @@ func responseToContentParams(resp *anthropic.Message) []anthropic.ContentBlockPa
 	return blocks
 }
 
-func processToolUse(ctx context.Context, resp *anthropic.Message, handle func(ctx context.Context, name string, args map[string]any) (map[string]any, error)) ([]anthropic.ContentBlockParamUnion, model.Content) {
+func processToolUse(ctx context.Context, resp *anthropic.Message, handle func(ctx context.Context, name string, args map[string]any) (agent.FunctionResult, error)) ([]anthropic.ContentBlockParamUnion, model.Content) {
 	var toolResults []anthropic.ContentBlockParamUnion
 	userContent := model.Content{Role: "user"}
 
@@ -284,16 +358,17 @@ func processToolUse(ctx context.Context, resp *anthropic.Message, handle func(ct
 		if err != nil {
 			resultStr = fmt.Sprintf(`{"error": %q}`, err.Error())
 		} else {
-			b, _ := json.Marshal(result)
+			b, _ := json.Marshal(result.Response)
 			resultStr = string(b)
 		}
 
-		toolResults = append(toolResults, anthropic.NewToolResultBlock(tb.ID, resultStr, err != nil))
+		toolResults = append(toolResults, toolResultBlock(tb.ID, resultStr, result.Parts, err != nil))
 		userContent.Parts = append(userContent.Parts, model.Part{
 			FunctionResponse: &model.FunctionResponse{
 				ID:       tb.ID,
 				Name:     tb.Name,
-				Response: result,
+				Response: result.Response,
+				Parts:    result.Parts,
 			},
 		})
 	}
@@ -21,15 +21,32 @@ func New(client *genai.Client, modelName string) *Provider {
 	return &Provider{client: client, model: modelName}
 }
 
+func (p *Provider) modelFor(req agent.ProviderRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return p.model
+}
+
+func generateConfig(req agent.ProviderRequest) *genai.GenerateContentConfig {
+	config := &genai.GenerateContentConfig{
+		Tools: buildTools(req.Tools),
+	}
+	if req.SystemInstruction != "" {
+		config.SystemInstruction = &genai.Content{
+			Parts: []*genai.Part{{Text: req.SystemInstruction}},
+		}
+	}
+	if req.MaxTokens > 0 {
+		config.MaxOutputTokens = int32(req.MaxTokens)
+	}
+	return config
+}
+
 func (p *Provider) Send(ctx context.Context, req agent.ProviderRequest) ([]model.Content, error) {
 	initialHistory := toGenAIContents(req.History)
 
-	chat, err := p.client.Chats.Create(ctx, p.model, &genai.GenerateContentConfig{
-		SystemInstruction: &genai.Content{
-			Parts: []*genai.Part{{Text: req.SystemInstruction}},
-		},
-		Tools: buildTools(req.Tools),
-	}, initialHistory)
+	chat, err := p.client.Chats.Create(ctx, p.modelFor(req), generateConfig(req), initialHistory)
 	if err != nil {
 		return nil, err
 	}
@@ -51,12 +68,7 @@ func (p *Provider) Send(ctx context.Context, req agent.ProviderRequest) ([]model
 func (p *Provider) SendStream(ctx context.Context, req agent.ProviderRequest, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error) ([]model.Content, error) {
 	initialHistory := toGenAIContents(req.History)
 
-	chat, err := p.client.Chats.Create(ctx, p.model, &genai.GenerateContentConfig{
-		SystemInstruction: &genai.Content{
-			Parts: []*genai.Part{{Text: req.SystemInstruction}},
-		},
-		Tools: buildTools(req.Tools),
-	}, initialHistory)
+	chat, err := p.client.Chats.Create(ctx, p.modelFor(req), generateConfig(req), initialHistory)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +86,9 @@ func (p *Provider) SendStream(ctx context.Context, req agent.ProviderRequest, on
 }
 
 func buildTools(fns map[string]*agent.FunctionDeclaration) []*genai.Tool {
+	if len(fns) == 0 {
+		return nil
+	}
 	decls := make([]*genai.FunctionDeclaration, 0, len(fns))
 	for _, fd := range fns {
 		decls = append(decls, &genai.FunctionDeclaration{
@@ -171,7 +186,9 @@ func collectDefs(node any, out map[string]any) {
 	}
 }
 
-func processResponse(ctx context.Context, chat *genai.Chat, resp *genai.GenerateContentResponse, handle func(ctx context.Context, name string, args map[string]any) (map[string]any, error)) error {
+func processResponse(ctx context.Context, chat *genai.Chat, resp *genai.GenerateContentResponse, handle func(ctx context.Context, name string, args map[string]any) (agent.FunctionResult, error)) error {
+	recordUsage(ctx, resp)
+
 	var functionResponses []genai.Part
 
 	for _, candidate := range resp.Candidates {
@@ -190,7 +207,8 @@ func processResponse(ctx context.Context, chat *genai.Chat, resp *genai.Generate
 				FunctionResponse: &genai.FunctionResponse{
 					ID:       part.FunctionCall.ID,
 					Name:     part.FunctionCall.Name,
-					Response: funcResp,
+					Response: funcResp.Response,
+					Parts:    toFunctionResponseParts(funcResp.Parts),
 				},
 			})
 		}
@@ -207,14 +225,19 @@ func processResponse(ctx context.Context, chat *genai.Chat, resp *genai.Generate
 	return nil
 }
 
-func processResponseStream(ctx context.Context, chat *genai.Chat, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error, handle func(ctx context.Context, name string, args map[string]any) (map[string]any, error), streamFn func() iter.Seq2[*genai.GenerateContentResponse, error]) error {
+func processResponseStream(ctx context.Context, chat *genai.Chat, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error, handle func(ctx context.Context, name string, args map[string]any) (agent.FunctionResult, error), streamFn func() iter.Seq2[*genai.GenerateContentResponse, error]) error {
 	var pendingCalls []*genai.FunctionCall
 
 	// Phase 1: stream text and collect function calls (without notifying yet).
+	// Usage metadata is cumulative, so only the last chunk's is reported.
+	var last *genai.GenerateContentResponse
 	for resp, err := range streamFn() {
 		if err != nil {
 			return err
 		}
+		if resp.UsageMetadata != nil {
+			last = resp
+		}
 		for _, candidate := range resp.Candidates {
 			if candidate == nil || candidate.Content == nil {
 				continue
@@ -232,6 +255,10 @@ func processResponseStream(ctx context.Context, chat *genai.Chat, onText func(st
 		}
 	}
 
+	if last != nil {
+		recordUsage(ctx, last)
+	}
+
 	// Phase 2: LLM turn is done — let the frontend remove the typing indicator.
 	if onTurnDone != nil {
 		if err := onTurnDone(); err != nil {
@@ -255,7 +282,8 @@ func processResponseStream(ctx context.Context, chat *genai.Chat, onText func(st
 			FunctionResponse: &genai.FunctionResponse{
 				ID:       fc.ID,
 				Name:     fc.Name,
-				Response: funcResp,
+				Response: funcResp.Response,
+				Parts:    toFunctionResponseParts(funcResp.Parts),
 			},
 		})
 	}
@@ -269,12 +297,29 @@ func processResponseStream(ctx context.Context, chat *genai.Chat, onText func(st
 	return nil
 }
 
+// recordUsage reports the tokens billed for resp. Tool results sent back to
+// the model count as input and thinking tokens as output.
+func recordUsage(ctx context.Context, resp *genai.GenerateContentResponse) {
+	u := resp.UsageMetadata
+	if u == nil {
+		return
+	}
+	agent.RecordUsage(ctx, agent.Usage{
+		Model:        resp.ModelVersion,
+		InputTokens:  int64(u.PromptTokenCount) + int64(u.ToolUsePromptTokenCount),
+		OutputTokens: int64(u.CandidatesTokenCount) + int64(u.ThoughtsTokenCount),
+	})
+}
+
 func toModelContents(contents []*genai.Content) []model.Content {
 	result := make([]model.Content, 0, len(contents))
 	for _, c := range contents {
 		mc := model.Content{Role: c.Role, Parts: make([]model.Part, 0, len(c.Parts))}
 		for _, p := range c.Parts {
 			mp := model.Part{Text: p.Text}
+			if p.InlineData != nil {
+				mp.InlineData = &model.InlineData{MIMEType: p.InlineData.MIMEType, Data: p.InlineData.Data}
+			}
 			if p.FunctionCall != nil {
 				mp.FunctionCall = &model.FunctionCall{
 					ID:   p.FunctionCall.ID,
@@ -287,6 +332,7 @@ func toModelContents(contents []*genai.Content) []model.Content {
 					ID:       p.FunctionResponse.ID,
 					Name:     p.FunctionResponse.Name,
 					Response: p.FunctionResponse.Response,
+					Parts:    fromFunctionResponseParts(p.FunctionResponse.Parts),
 				}
 			}
 			mc.Parts = append(mc.Parts, mp)
@@ -302,6 +348,9 @@ func toGenAIContents(contents []model.Content) []*genai.Content {
 		gc := &genai.Content{Role: c.Role, Parts: make([]*genai.Part, 0, len(c.Parts))}
 		for _, p := range c.Parts {
 			gp := &genai.Part{Text: p.Text}
+			if p.InlineData != nil {
+				gp.InlineData = &genai.Blob{MIMEType: p.InlineData.MIMEType, Data: p.InlineData.Data}
+			}
 			if p.FunctionCall != nil {
 				gp.FunctionCall = &genai.FunctionCall{
 					ID:   p.FunctionCall.ID,
@@ -314,6 +363,7 @@ func toGenAIContents(contents []model.Content) []*genai.Content {
 					ID:       p.FunctionResponse.ID,
 					Name:     p.FunctionResponse.Name,
 					Response: p.FunctionResponse.Response,
+					Parts:    toFunctionResponseParts(p.FunctionResponse.Parts),
 				}
 			}
 			gc.Parts = append(gc.Parts, gp)
@@ -323,5 +373,39 @@ func toGenAIContents(contents []model.Content) []*genai.Content {
 	return result
 }
 
+// toFunctionResponseParts converts media returned by a tool into the parts
+// Gemini accepts alongside a function response.
+func toFunctionResponseParts(parts []model.Part) []*genai.FunctionResponsePart {
+	var result []*genai.FunctionResponsePart
+	for _, p := range parts {
+		if p.InlineData == nil {
+			continue
+		}
+		result = append(result, &genai.FunctionResponsePart{
+			InlineData: &genai.FunctionResponseBlob{
+				MIMEType:    p.InlineData.MIMEType,
+				Data:        p.InlineData.Data,
+				DisplayName: p.InlineData.URI,
+			},
+		})
+	}
+	return result
+}
+
+func fromFunctionResponseParts(parts []*genai.FunctionResponsePart) []model.Part {
+	var result []model.Part
+	for _, p := range parts {
+		if p == nil || p.InlineData == nil {
+			continue
+		}
+		result = append(result, model.Part{InlineData: &model.InlineData{
+			MIMEType: p.InlineData.MIMEType,
+			Data:     p.InlineData.Data,
+			URI:      p.InlineData.DisplayName,
+		}})
+	}
+	return result
+}
+
 // Ensure the interface is satisfied at compile time.
 var _ agent.LLMProvider = (*Provider)(nil)
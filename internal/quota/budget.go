@@ -0,0 +1,212 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+)
+
+// Budget caps what a tenant may spend per UTC day. Zero fields are
+// unlimited.
+type Budget struct {
+	DailyTokens int64 `json:"dailyTokens,omitempty"`
+
+	// DailyCost is in the currency of the prices, usually US dollars.
+	DailyCost float64 `json:"dailyCost,omitempty"`
+}
+
+// Spend is what a tenant consumed on one day.
+type Spend struct {
+	InputTokens  int64   `json:"input_tokens" bson:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens" bson:"output_tokens"`
+	Cost         float64 `json:"cost" bson:"cost"`
+}
+
+// Tokens returns the input and output tokens of s.
+func (s Spend) Tokens() int64 {
+	return s.InputTokens + s.OutputTokens
+}
+
+// Store keeps the daily spend of each tenant. Days are formatted as
+// time.DateOnly in UTC.
+type Store interface {
+	// Spend returns what tenant spent on day; zero if nothing was recorded.
+	Spend(ctx context.Context, tenant, day string) (Spend, error)
+
+	// Add adds s to what tenant spent on day and returns the new total.
+	Add(ctx context.Context, tenant, day string, s Spend) (Spend, error)
+}
+
+// Price is the cost of a model per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Prices maps model names to their price. A name also prices the models it
+// is a prefix of, so "claude-sonnet-4-5" covers dated versions.
+type Prices map[string]Price
+
+// LoadPrices reads a JSON object of model names to prices from path.
+func LoadPrices(path string) (Prices, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("quota: read prices: %w", err)
+	}
+	var prices Prices
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("quota: parse prices %s: %w", path, err)
+	}
+	return prices, nil
+}
+
+// Lookup returns the price of model: the exact entry if there is one, else
+// the longest entry model starts with.
+func (p Prices) Lookup(model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	var (
+		best  Price
+		found string
+	)
+	for name, price := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(found) {
+			best, found = price, name
+		}
+	}
+	return best, found != ""
+}
+
+// Meter records the usage of one tenant and enforces its daily budget.
+type Meter struct {
+	tenant string
+	budget Budget
+	store  Store
+	prices Prices
+
+	// unpriced remembers the models already reported as missing a price.
+	unpriced sync.Map
+}
+
+// NewMeter creates a meter for tenant. Usage is recorded in store even when
+// the budget is unlimited.
+func NewMeter(tenant string, budget Budget, store Store, prices Prices) *Meter {
+	return &Meter{tenant: tenant, budget: budget, store: store, prices: prices}
+}
+
+// Check returns a *LimitError, valid until the next UTC day, when the tenant
+// has used up its budget for today.
+func (m *Meter) Check(ctx context.Context) error {
+	if m.budget == (Budget{}) {
+		return nil
+	}
+	now := time.Now().UTC()
+	spend, err := m.store.Spend(ctx, m.tenant, now.Format(time.DateOnly))
+	if err != nil {
+		return err
+	}
+	return m.exceeded(spend, now)
+}
+
+// Record adds the usage of a model call to today's spend. It returns a
+// *LimitError when the call used up the budget.
+func (m *Meter) Record(ctx context.Context, u agent.Usage) error {
+	s := Spend{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens}
+	if price, ok := m.prices.Lookup(u.Model); ok {
+		s.Cost = (float64(u.InputTokens)*price.Input + float64(u.OutputTokens)*price.Output) / 1e6
+	} else if _, warned := m.unpriced.LoadOrStore(u.Model, true); !warned && m.budget.DailyCost > 0 {
+		log.Printf("quota: tenant %q: no price for model %q; its calls are not counted against the cost budget", m.tenant, u.Model)
+	}
+
+	now := time.Now().UTC()
+	spend, err := m.store.Add(ctx, m.tenant, now.Format(time.DateOnly), s)
+	if err != nil {
+		return err
+	}
+	return m.exceeded(spend, now)
+}
+
+func (m *Meter) exceeded(spend Spend, now time.Time) error {
+	var limit string
+	switch {
+	case m.budget.DailyTokens > 0 && spend.Tokens() >= m.budget.DailyTokens:
+		limit = fmt.Sprintf("daily token budget of tenant %q (%d tokens)", m.tenant, m.budget.DailyTokens)
+	case m.budget.DailyCost > 0 && spend.Cost >= m.budget.DailyCost:
+		limit = fmt.Sprintf("daily cost budget of tenant %q (%g)", m.tenant, m.budget.DailyCost)
+	default:
+		return nil
+	}
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return &LimitError{Limit: limit, RetryAfter: tomorrow.Sub(now)}
+}
+
+// Provider wraps p so that every model call is metered: calls are refused
+// once the budget is used up, and a turn whose model calls use it up is
+// stopped before the next call.
+func (m *Meter) Provider(p agent.LLMProvider) agent.LLMProvider {
+	return &meteredProvider{LLMProvider: p, meter: m}
+}
+
+type meteredProvider struct {
+	agent.LLMProvider
+	meter *Meter
+}
+
+// begin checks the budget and returns a context recording usage, which is
+// cancelled with the *LimitError once the budget is used up.
+func (p *meteredProvider) begin(ctx context.Context) (context.Context, context.CancelCauseFunc, error) {
+	if err := p.meter.Check(ctx); err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	ctx = agent.WithUsageRecorder(ctx, func(ctx context.Context, u agent.Usage) {
+		// Spend is recorded even if the caller went away meanwhile.
+		err := p.meter.Record(context.WithoutCancel(ctx), u)
+		if errors.Is(err, ErrLimitExceeded) {
+			cancel(err)
+		} else if err != nil {
+			log.Printf("quota: tenant %q: record usage: %v", p.meter.tenant, err)
+		}
+	})
+	return ctx, cancel, nil
+}
+
+// end replaces err with the *LimitError that stopped the turn, if any.
+func end(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); err != nil && errors.Is(cause, ErrLimitExceeded) {
+		return cause
+	}
+	return err
+}
+
+func (p *meteredProvider) Send(ctx context.Context, req agent.ProviderRequest) ([]model.Content, error) {
+	ctx, cancel, err := p.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel(nil)
+
+	contents, err := p.LLMProvider.Send(ctx, req)
+	return contents, end(ctx, err)
+}
+
+func (p *meteredProvider) SendStream(ctx context.Context, req agent.ProviderRequest, onText func(string) error, onFunctionCall func(name string, args map[string]any) error, onTurnDone func() error) ([]model.Content, error) {
+	ctx, cancel, err := p.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel(nil)
+
+	contents, err := p.LLMProvider.SendStream(ctx, req, onText, onFunctionCall, onTurnDone)
+	return contents, end(ctx, err)
+}
@@ -0,0 +1,168 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/m2tx/agent_example/internal/agent"
+	"github.com/m2tx/agent_example/internal/model"
+)
+
+func TestPricesLookup(t *testing.T) {
+	prices := Prices{
+		"claude":            {Input: 1, Output: 1},
+		"claude-sonnet-4-5": {Input: 3, Output: 15},
+		"gpt-4o":            {Input: 2.5, Output: 10},
+	}
+
+	tests := []struct {
+		model string
+		want  Price
+		ok    bool
+	}{
+		{"gpt-4o", Price{Input: 2.5, Output: 10}, true},
+		{"claude-sonnet-4-5-20250929", Price{Input: 3, Output: 15}, true},
+		{"claude-haiku-4-5", Price{Input: 1, Output: 1}, true},
+		{"gemini-2.5-pro", Price{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := prices.Lookup(tt.model)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %+v, %v; want %+v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMeterTokenBudget(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	m := NewMeter("support", Budget{DailyTokens: 100}, store, nil)
+
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check before any usage: %v", err)
+	}
+	if err := m.Record(ctx, agent.Usage{Model: "m", InputTokens: 40, OutputTokens: 20}); err != nil {
+		t.Fatalf("Record within the budget: %v", err)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check within the budget: %v", err)
+	}
+
+	err := m.Record(ctx, agent.Usage{Model: "m", InputTokens: 30, OutputTokens: 10})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Record reaching the budget = %v, want a *LimitError", err)
+	}
+	if limitErr.RetryAfter <= 0 || limitErr.RetryAfter > 24*time.Hour {
+		t.Errorf("RetryAfter = %s, want the time until the next UTC day", limitErr.RetryAfter)
+	}
+	if err := m.Check(ctx); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Check after the budget is used up = %v, want ErrLimitExceeded", err)
+	}
+
+	// Budgets are per tenant.
+	if err := NewMeter("hr", Budget{DailyTokens: 100}, store, nil).Check(ctx); err != nil {
+		t.Errorf("other tenant: %v", err)
+	}
+}
+
+func TestMeterCostBudget(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	m := NewMeter("support", Budget{DailyCost: 1}, store, Prices{"claude-sonnet-4-5": {Input: 3, Output: 15}})
+
+	// 100k input and 20k output tokens cost 0.30 + 0.30.
+	if err := m.Record(ctx, agent.Usage{Model: "claude-sonnet-4-5-20250929", InputTokens: 100_000, OutputTokens: 20_000}); err != nil {
+		t.Fatalf("Record within the budget: %v", err)
+	}
+	spend, _ := store.Spend(ctx, "support", time.Now().UTC().Format(time.DateOnly))
+	if math.Abs(spend.Cost-0.6) > 1e-9 || spend.Tokens() != 120_000 {
+		t.Errorf("spend = %+v, want 120000 tokens costing 0.6", spend)
+	}
+
+	// Unpriced models are counted in tokens only.
+	if err := m.Record(ctx, agent.Usage{Model: "unknown", InputTokens: 1_000_000}); err != nil {
+		t.Fatalf("Record of an unpriced model: %v", err)
+	}
+
+	if err := m.Record(ctx, agent.Usage{Model: "claude-sonnet-4-5", InputTokens: 100_000, OutputTokens: 20_000}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Record reaching the budget = %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestMeterUnlimited(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	m := NewMeter("support", Budget{}, store, nil)
+
+	if err := m.Record(ctx, agent.Usage{InputTokens: 1 << 40}); err != nil {
+		t.Fatalf("Record without a budget: %v", err)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check without a budget: %v", err)
+	}
+	// Usage is still recorded.
+	if spend, _ := store.Spend(ctx, "support", time.Now().UTC().Format(time.DateOnly)); spend.InputTokens != 1<<40 {
+		t.Errorf("spend = %+v, want the recorded usage", spend)
+	}
+}
+
+// fakeProvider reports usage for each of its model calls, stopping when ctx
+// is cancelled as a real provider does between tool call rounds.
+type fakeProvider struct {
+	calls []agent.Usage
+	made  int
+}
+
+func (p *fakeProvider) Send(ctx context.Context, _ agent.ProviderRequest) ([]model.Content, error) {
+	for _, u := range p.calls {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p.made++
+		agent.RecordUsage(ctx, u)
+	}
+	return []model.Content{{Role: "model", Parts: []model.Part{{Text: "done"}}}}, nil
+}
+
+func (p *fakeProvider) SendStream(ctx context.Context, req agent.ProviderRequest, _ func(string) error, _ func(string, map[string]any) error, _ func() error) ([]model.Content, error) {
+	return p.Send(ctx, req)
+}
+
+func TestMeteredProvider(t *testing.T) {
+	ctx := context.Background()
+	m := NewMeter("support", Budget{DailyTokens: 100}, NewMemoryStore(), nil)
+	inner := &fakeProvider{calls: []agent.Usage{{InputTokens: 60}, {InputTokens: 60}, {InputTokens: 60}}}
+	p := m.Provider(inner)
+
+	// The second call uses up the budget and the turn stops before the third.
+	_, err := p.Send(ctx, agent.ProviderRequest{})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Send using up the budget = %v, want ErrLimitExceeded", err)
+	}
+	if inner.made != 2 {
+		t.Errorf("made %d model calls, want 2", inner.made)
+	}
+
+	// Later turns are refused without calling the model.
+	inner.made = 0
+	if _, err := p.SendStream(ctx, agent.ProviderRequest{}, nil, nil, nil); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("SendStream over the budget = %v, want ErrLimitExceeded", err)
+	}
+	if inner.made != 0 {
+		t.Errorf("made %d model calls over the budget, want 0", inner.made)
+	}
+}
+
+func TestMeteredProviderWithinBudget(t *testing.T) {
+	m := NewMeter("support", Budget{DailyTokens: 1000}, NewMemoryStore(), nil)
+	inner := &fakeProvider{calls: []agent.Usage{{InputTokens: 60}, {InputTokens: 60}}}
+
+	contents, err := m.Provider(inner).Send(context.Background(), agent.ProviderRequest{})
+	if err != nil || len(contents) != 1 || inner.made != 2 {
+		t.Fatalf("Send = %+v, %v after %d calls; want the answer after 2", contents, err, inner.made)
+	}
+}
@@ -0,0 +1,30 @@
+// Package quota limits how much each caller and tenant may use the agent:
+// request rates per user and per client address, and daily token and cost
+// budgets per tenant.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLimitExceeded is matched by every LimitError.
+var ErrLimitExceeded = errors.New("quota: limit exceeded")
+
+// LimitError reports a limit that was hit and when to try again.
+type LimitError struct {
+	// Limit describes the limit, such as "rate limit for user alice".
+	Limit string
+
+	// RetryAfter is how long until the limit allows another request.
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeded; retry in %s", e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
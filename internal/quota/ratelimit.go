@@ -0,0 +1,87 @@
+package quota
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that refilled completely are dropped.
+const sweepInterval = time.Minute
+
+// Limiter is an in-memory token bucket per key, such as a user or a client
+// address. Each request takes one token; buckets refill continuously at the
+// configured rate up to their burst size.
+type Limiter struct {
+	name  string
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewLimiter creates a limiter allowing perMinute requests per minute for
+// each key, with bursts of up to burst requests. name describes the keys in
+// errors, such as "user". A limiter with perMinute <= 0 allows everything.
+func NewLimiter(name string, perMinute, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		name:    name,
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. It returns a *LimitError with the
+// time until the next token when the bucket is empty.
+func (l *Limiter) Allow(key string) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return &LimitError{Limit: fmt.Sprintf("rate limit for %s %s", l.name, key), RetryAfter: wait}
+	}
+	b.tokens--
+	return nil
+}
+
+// sweep forgets keys whose buckets would be full by now, which behave like
+// unseen keys. l.mu must be held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
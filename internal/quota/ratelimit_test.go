@@ -0,0 +1,79 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	l := NewLimiter("user", 60, 3)
+
+	for i := range 3 {
+		if err := l.Allow("alice"); err != nil {
+			t.Fatalf("request %d within the burst: %v", i+1, err)
+		}
+	}
+
+	err := l.Allow("alice")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("request over the burst = %v, want a *LimitError", err)
+	}
+	if limitErr.RetryAfter <= 0 || limitErr.RetryAfter > time.Second {
+		t.Errorf("RetryAfter = %s, want up to the one second a token takes", limitErr.RetryAfter)
+	}
+	if limitErr.Limit != "rate limit for user alice" {
+		t.Errorf("Limit = %q", limitErr.Limit)
+	}
+
+	// Keys have separate buckets.
+	if err := l.Allow("bob"); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := NewLimiter("user", 60, 1)
+	if err := l.Allow("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Allow("alice"); err == nil {
+		t.Fatal("empty bucket allowed a request")
+	}
+
+	// Age the bucket by the time one token takes.
+	l.buckets["alice"].updated = l.buckets["alice"].updated.Add(-time.Second)
+	if err := l.Allow("alice"); err != nil {
+		t.Errorf("refilled bucket: %v", err)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := NewLimiter("address", 60, 2)
+	l.Allow("a")
+	l.Allow("b")
+	l.Allow("b")
+
+	// a refilled completely, b has not.
+	l.buckets["a"].updated = l.buckets["a"].updated.Add(-time.Second)
+	l.lastSweep = time.Now().Add(-sweepInterval)
+	l.Allow("c")
+
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("partly used bucket was swept")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	for _, l := range []*Limiter{nil, NewLimiter("user", 0, 1)} {
+		for range 10 {
+			if err := l.Allow("alice"); err != nil {
+				t.Fatalf("disabled limiter: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MemoryStore keeps spend in memory. It is lost on restart and not shared
+// between replicas.
+type MemoryStore struct {
+	mu    sync.Mutex
+	spend map[string]Spend
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{spend: make(map[string]Spend)}
+}
+
+func (s *MemoryStore) Spend(_ context.Context, tenant, day string) (Spend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.spend[tenant+"/"+day], nil
+}
+
+func (s *MemoryStore) Add(_ context.Context, tenant, day string, add Spend) (Spend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only today's spend is ever read, so earlier days are dropped.
+	for key := range s.spend {
+		if !strings.HasSuffix(key, "/"+day) {
+			delete(s.spend, key)
+		}
+	}
+
+	key := tenant + "/" + day
+	total := s.spend[key]
+	total.InputTokens += add.InputTokens
+	total.OutputTokens += add.OutputTokens
+	total.Cost += add.Cost
+	s.spend[key] = total
+	return total, nil
+}
+
+type spendDocument struct {
+	ID     string `bson:"_id"`
+	Tenant string `bson:"tenant"`
+	Day    string `bson:"day"`
+	Spend  `bson:",inline"`
+}
+
+// MongoStore keeps spend in MongoDB, one document per tenant and day, so
+// budgets hold across restarts and replicas.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore creates a MongoStore. collectionName defaults to "quota"
+// if empty.
+func NewMongoStore(db *mongo.Database, collectionName string) *MongoStore {
+	if collectionName == "" {
+		collectionName = "quota"
+	}
+	return &MongoStore{collection: db.Collection(collectionName)}
+}
+
+func (s *MongoStore) Spend(ctx context.Context, tenant, day string) (Spend, error) {
+	var doc spendDocument
+	err := s.collection.FindOne(ctx, bson.M{"_id": tenant + "/" + day}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return Spend{}, nil
+	}
+	if err != nil {
+		return Spend{}, fmt.Errorf("quota: find spend of %q on %s: %w", tenant, day, err)
+	}
+	return doc.Spend, nil
+}
+
+func (s *MongoStore) Add(ctx context.Context, tenant, day string, add Spend) (Spend, error) {
+	filter := bson.M{"_id": tenant + "/" + day}
+	update := bson.M{
+		"$set": bson.M{"tenant": tenant, "day": day},
+		"$inc": bson.M{
+			"input_tokens":  add.InputTokens,
+			"output_tokens": add.OutputTokens,
+			"cost":          add.Cost,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var doc spendDocument
+	if err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc); err != nil {
+		return Spend{}, fmt.Errorf("quota: add spend of %q on %s: %w", tenant, day, err)
+	}
+	return doc.Spend, nil
+}
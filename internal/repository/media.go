@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/m2tx/agent_example/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxMediaBytes is the largest media item stored; bigger ones would exceed
+// MongoDB's 16MB document limit and are left out of the saved history.
+const maxMediaBytes = 15 << 20
+
+// mediaDocument is one media item of a session, stored apart from the
+// session document so images and audio returned by tools do not count
+// towards its size limit.
+type mediaDocument struct {
+	ID       string `bson:"_id"`
+	Session  string `bson:"session"`
+	MIMEType string `bson:"mime_type"`
+	Data     []byte `bson:"data"`
+}
+
+// storeMedia saves the media of history in r.media and returns a copy of
+// history referencing it instead of embedding the bytes.
+func (r *MongoSessionRepository) storeMedia(ctx context.Context, sessionID string, history []model.Content) ([]model.Content, error) {
+	return mapInlineData(history, func(d model.InlineData) (*model.InlineData, error) {
+		if len(d.Data) == 0 {
+			return &d, nil
+		}
+		if len(d.Data) > maxMediaBytes {
+			log.Printf("repository: session %q: not saving %d bytes of %s", sessionID, len(d.Data), d.MIMEType)
+			return nil, nil
+		}
+
+		sum := sha256.Sum256(d.Data)
+		ref := sessionID + "/" + hex.EncodeToString(sum[:])
+
+		// Every turn saves the whole history, so most media is already
+		// stored; check before sending the bytes again.
+		n, err := r.media.CountDocuments(ctx, bson.M{"_id": ref}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, fmt.Errorf("repository: store media of session %q: %w", sessionID, err)
+		}
+		if n == 0 {
+			_, err := r.media.UpdateOne(ctx,
+				bson.M{"_id": ref},
+				bson.M{"$setOnInsert": mediaDocument{ID: ref, Session: sessionID, MIMEType: d.MIMEType, Data: d.Data}},
+				options.Update().SetUpsert(true))
+			if err != nil {
+				return nil, fmt.Errorf("repository: store media of session %q: %w", sessionID, err)
+			}
+		}
+
+		d.Data, d.Ref = nil, ref
+		return &d, nil
+	})
+}
+
+// loadMedia returns a copy of history with the media referenced by it read
+// back from r.media.
+func (r *MongoSessionRepository) loadMedia(ctx context.Context, sessionID string, history []model.Content) ([]model.Content, error) {
+	return mapInlineData(history, func(d model.InlineData) (*model.InlineData, error) {
+		if d.Ref == "" {
+			return &d, nil
+		}
+
+		var doc mediaDocument
+		err := r.media.FindOne(ctx, bson.M{"_id": d.Ref}).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			log.Printf("repository: session %q: media %q is missing", sessionID, d.Ref)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("repository: load media of session %q: %w", sessionID, err)
+		}
+
+		d.Data, d.Ref = doc.Data, ""
+		return &d, nil
+	})
+}
+
+// mapInlineData returns a copy of history with every inline data part,
+// including those of function responses, replaced by f's result. Parts for
+// which f returns nil are replaced by a note that the media was left out.
+// history is not modified.
+func mapInlineData(history []model.Content, f func(model.InlineData) (*model.InlineData, error)) ([]model.Content, error) {
+	var mapParts func(parts []model.Part) ([]model.Part, error)
+	mapParts = func(parts []model.Part) ([]model.Part, error) {
+		out := make([]model.Part, len(parts))
+		for i, p := range parts {
+			switch {
+			case p.InlineData != nil:
+				d, err := f(*p.InlineData)
+				if err != nil {
+					return nil, err
+				}
+				if d == nil {
+					p = model.Part{Text: fmt.Sprintf("[%s omitted from the saved conversation]", p.InlineData.MIMEType)}
+				} else {
+					p.InlineData = d
+				}
+			case p.FunctionResponse != nil && len(p.FunctionResponse.Parts) > 0:
+				resp := *p.FunctionResponse
+				mapped, err := mapParts(resp.Parts)
+				if err != nil {
+					return nil, err
+				}
+				resp.Parts = mapped
+				p.FunctionResponse = &resp
+			}
+			out[i] = p
+		}
+		return out, nil
+	}
+
+	out := make([]model.Content, len(history))
+	for i, c := range history {
+		parts, err := mapParts(c.Parts)
+		if err != nil {
+			return nil, err
+		}
+		c.Parts = parts
+		out[i] = c
+	}
+	return out, nil
+}
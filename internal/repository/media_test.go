@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMapInlineData(t *testing.T) {
+	image := []byte("\x89PNG not really")
+	history := []model.Content{
+		{Role: "user", Parts: []model.Part{{Text: "what is in this image?"}, {InlineData: &model.InlineData{MIMEType: "image/png", Data: image}}}},
+		{Role: "model", Parts: []model.Part{{FunctionCall: &model.FunctionCall{Name: "screenshot"}}}},
+		{Role: "user", Parts: []model.Part{{FunctionResponse: &model.FunctionResponse{
+			Name:     "screenshot",
+			Response: map[string]any{"ok": true},
+			Parts: []model.Part{
+				{InlineData: &model.InlineData{MIMEType: "image/png", Data: image}},
+				{InlineData: &model.InlineData{MIMEType: "audio/wav", Data: []byte("huge")}},
+			},
+		}}}},
+	}
+
+	stored, err := mapInlineData(history, func(d model.InlineData) (*model.InlineData, error) {
+		if d.MIMEType == "audio/wav" {
+			return nil, nil
+		}
+		d.Data, d.Ref = nil, "s/"+d.MIMEType
+		return &d, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := stored[0].Parts[1].InlineData; got.Data != nil || got.Ref != "s/image/png" {
+		t.Errorf("user image = %+v, want a reference", got)
+	}
+	parts := stored[2].Parts[0].FunctionResponse.Parts
+	if got := parts[0].InlineData; got.Data != nil || got.Ref != "s/image/png" {
+		t.Errorf("tool image = %+v, want a reference", got)
+	}
+	if parts[1].InlineData != nil || !strings.Contains(parts[1].Text, "audio/wav omitted") {
+		t.Errorf("dropped media = %+v, want a note", parts[1])
+	}
+	if stored[0].Parts[0].Text != "what is in this image?" || stored[1].Parts[0].FunctionCall.Name != "screenshot" {
+		t.Errorf("other parts changed: %+v", stored)
+	}
+
+	// The caller's history keeps its media.
+	if !bytes.Equal(history[0].Parts[1].InlineData.Data, image) ||
+		!bytes.Equal(history[2].Parts[0].FunctionResponse.Parts[0].InlineData.Data, image) ||
+		history[2].Parts[0].FunctionResponse.Parts[1].InlineData == nil {
+		t.Error("mapInlineData modified its input")
+	}
+
+	// The session document no longer holds the bytes.
+	data, err := bson.Marshal(sessionDocument{ID: "s", History: stored})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, image) {
+		t.Error("session document still embeds the media")
+	}
+}
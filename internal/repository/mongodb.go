@@ -13,11 +13,15 @@ import (
 type sessionDocument struct {
 	ID      string          `bson:"_id"`
 	History []model.Content `bson:"history"`
+	Owner   string          `bson:"owner,omitempty"`
 }
 
-// MongoSessionRepository implements SessionRepository using MongoDB.
+// MongoSessionRepository implements SessionRepository using MongoDB. Media
+// in the history is kept in a separate collection named after the sessions
+// collection with a "_media" suffix.
 type MongoSessionRepository struct {
 	collection *mongo.Collection
+	media      *mongo.Collection
 }
 
 // NewMongoSessionRepository creates a new MongoSessionRepository.
@@ -28,10 +32,16 @@ func NewMongoSessionRepository(db *mongo.Database, collectionName string) *Mongo
 	}
 	return &MongoSessionRepository{
 		collection: db.Collection(collectionName),
+		media:      db.Collection(collectionName + "_media"),
 	}
 }
 
 func (r *MongoSessionRepository) Save(ctx context.Context, sessionID string, history []model.Content) error {
+	history, err := r.storeMedia(ctx, sessionID, history)
+	if err != nil {
+		return err
+	}
+
 	doc := sessionDocument{
 		ID:      sessionID,
 		History: history,
@@ -41,7 +51,7 @@ func (r *MongoSessionRepository) Save(ctx context.Context, sessionID string, his
 	update := bson.M{"$set": doc}
 	opts := options.Update().SetUpsert(true)
 
-	_, err := r.collection.UpdateOne(ctx, filter, update, opts)
+	_, err = r.collection.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		return fmt.Errorf("repository: upsert session %q: %w", sessionID, err)
 	}
@@ -61,7 +71,7 @@ func (r *MongoSessionRepository) Load(ctx context.Context, sessionID string) ([]
 		return nil, fmt.Errorf("repository: find session %q: %w", sessionID, err)
 	}
 
-	return doc.History, nil
+	return r.loadMedia(ctx, sessionID, doc.History)
 }
 
 func (r *MongoSessionRepository) Delete(ctx context.Context, sessionID string) error {
@@ -72,5 +82,51 @@ func (r *MongoSessionRepository) Delete(ctx context.Context, sessionID string) e
 		return fmt.Errorf("repository: delete session %q: %w", sessionID, err)
 	}
 
+	if _, err := r.media.DeleteMany(ctx, bson.M{"session": sessionID}); err != nil {
+		return fmt.Errorf("repository: delete media of session %q: %w", sessionID, err)
+	}
+
 	return nil
 }
+
+func (r *MongoSessionRepository) Claim(ctx context.Context, sessionID string, owner string) error {
+	// The upsert only matches an unowned session or one already owned by
+	// owner; for a session owned by someone else it tries to insert a second
+	// document with the same _id, which fails atomically.
+	filter := bson.M{
+		"_id": sessionID,
+		"$or": bson.A{
+			bson.M{"owner": bson.M{"$exists": false}},
+			bson.M{"owner": ""},
+			bson.M{"owner": owner},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner}}
+	opts := options.Update().SetUpsert(true)
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("repository: claim session %q: %w", sessionID, ErrSessionOwned)
+	}
+	if err != nil {
+		return fmt.Errorf("repository: claim session %q: %w", sessionID, err)
+	}
+
+	return nil
+}
+
+func (r *MongoSessionRepository) Owner(ctx context.Context, sessionID string) (string, error) {
+	filter := bson.M{"_id": sessionID}
+	opts := options.FindOne().SetProjection(bson.M{"owner": 1})
+
+	var doc sessionDocument
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("repository: find session %q: %w", sessionID, err)
+	}
+
+	return doc.Owner, nil
+}
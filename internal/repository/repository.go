@@ -2,10 +2,15 @@ package repository
 
 import (
 	"context"
+	"errors"
 
 	"github.com/m2tx/agent_example/internal/model"
 )
 
+// ErrSessionOwned is returned by SessionRepository.Claim when the session
+// belongs to another owner.
+var ErrSessionOwned = errors.New("session belongs to another user")
+
 // SessionRepository defines persistence operations for conversation history.
 type SessionRepository interface {
 	// Save persists the full history for a given session.
@@ -19,4 +24,13 @@ type SessionRepository interface {
 	// Delete removes the stored history for a given session.
 	// Is a no-op if the session does not exist.
 	Delete(ctx context.Context, sessionID string) error
+
+	// Claim binds a session to owner, creating it if it does not exist.
+	// Sessions without an owner are claimed by the first caller; sessions
+	// owned by someone else fail with ErrSessionOwned.
+	Claim(ctx context.Context, sessionID string, owner string) error
+
+	// Owner returns the owner of a session.
+	// Returns "", nil if the session does not exist or has no owner.
+	Owner(ctx context.Context, sessionID string) (string, error)
 }
@@ -0,0 +1,231 @@
+// Package tenant describes the tenants served by one deployment: each gets
+// its own agent, with its own instructions, model, tools, MCP servers,
+// documents and sessions.
+package tenant
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/m2tx/agent_example/internal/auth"
+	"github.com/m2tx/agent_example/internal/quota"
+)
+
+// DefaultHeader selects the tenant of requests when authentication is
+// disabled.
+const DefaultHeader = "X-Tenant"
+
+var (
+	// ErrUnknownTenant is returned for requests naming a tenant that is not
+	// configured.
+	ErrUnknownTenant = errors.New("unknown tenant")
+
+	// ErrTenantForbidden is returned when a request names another tenant
+	// than the one its credentials are for.
+	ErrTenantForbidden = errors.New("tenant not allowed for these credentials")
+)
+
+// validName keeps tenant names usable in collection names and log lines.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Config lists the tenants of a deployment:
+//
+//	{
+//	  "default": "support",
+//	  "tenants": {
+//	    "support": {"systemInstructionFile": "support.md", "mcpConfig": "mcp.support.json"},
+//	    "hr": {
+//	      "systemInstruction": "You answer HR questions for employees.",
+//	      "provider": "anthropic", "model": "claude-opus-4-7",
+//	      "tools": ["search_docs", "get_collaborators"],
+//	      "docs": {"store": "mongodb", "collection": "hr_chunks"}
+//	    }
+//	  }
+//	}
+type Config struct {
+	// Default serves requests that name no tenant. It may be omitted when
+	// there is a single tenant.
+	Default string `json:"default,omitempty"`
+
+	// Header names the request header selecting a tenant when
+	// authentication is disabled; X-Tenant by default.
+	Header string `json:"header,omitempty"`
+
+	Tenants map[string]Tenant `json:"tenants"`
+}
+
+// Tenant configures the agent of one tenant. Empty fields fall back to the
+// server's environment configuration.
+type Tenant struct {
+	// Name identifies the tenant. It is filled from the map key.
+	Name string `json:"-"`
+
+	// SystemInstruction, or the contents of SystemInstructionFile, replaces
+	// the built-in system instruction.
+	SystemInstruction     string `json:"systemInstruction,omitempty"`
+	SystemInstructionFile string `json:"systemInstructionFile,omitempty"`
+
+	// Provider ("gemini" or "anthropic") and Model select the LLM.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+
+	// Tools lists the built-in tools enabled for the tenant. Nil enables all
+	// of them; an empty list none.
+	Tools []string `json:"tools,omitempty"`
+
+	// MCPConfig is the path of the tenant's mcpServers file. Without it the
+	// tenant connects to no MCP server.
+	MCPConfig string `json:"mcpConfig,omitempty"`
+
+	// Docs selects the tenant's knowledge base.
+	Docs Docs `json:"docs,omitzero"`
+
+	// Quota caps the tenant's daily spend; without it the server-wide
+	// budget applies.
+	Quota quota.Budget `json:"quota,omitzero"`
+
+	// Sampling approves the sampling requests of the tenant's MCP servers.
+	// Requests are denied unless the server is listed.
+	Sampling Sampling `json:"sampling,omitzero"`
+
+	// SessionNamespace keeps the tenant's conversations apart from other
+	// tenants'; it defaults to the tenant name.
+	SessionNamespace string `json:"sessionNamespace,omitempty"`
+}
+
+// Sampling lists the MCP servers whose sampling requests a tenant pays for.
+type Sampling struct {
+	// Servers names the servers allowed to sample; "*" allows every server
+	// with a sampling section.
+	Servers []string `json:"servers,omitempty"`
+}
+
+// Allows reports whether server may send sampling requests.
+func (s Sampling) Allows(server string) bool {
+	return slices.Contains(s.Servers, server) || slices.Contains(s.Servers, "*")
+}
+
+// Docs selects where a tenant's documents are indexed.
+type Docs struct {
+	// Store is "memory" (Dir indexed at startup) or "mongodb".
+	Store string `json:"store,omitempty"`
+	Dir   string `json:"dir,omitempty"`
+
+	// Collection and Index name the MongoDB collection and Atlas vector
+	// search index.
+	Collection string `json:"collection,omitempty"`
+	Index      string `json:"index,omitempty"`
+}
+
+// LoadConfig reads and validates a tenants file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tenant: read config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("tenant: parse config %q: %w", path, err)
+	}
+
+	if len(cfg.Tenants) == 0 {
+		return nil, fmt.Errorf("tenant: config %q defines no tenants", path)
+	}
+	if cfg.Default == "" && len(cfg.Tenants) == 1 {
+		for name := range cfg.Tenants {
+			cfg.Default = name
+		}
+	}
+	if _, ok := cfg.Tenants[cfg.Default]; cfg.Default != "" && !ok {
+		return nil, fmt.Errorf("tenant: default tenant %q is not defined", cfg.Default)
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultHeader
+	}
+
+	namespaces := make(map[string]string, len(cfg.Tenants))
+	for name, t := range cfg.Tenants {
+		t.Name = name
+		if !validName.MatchString(name) {
+			return nil, fmt.Errorf("tenant: invalid tenant name %q", name)
+		}
+		if t.SystemInstruction != "" && t.SystemInstructionFile != "" {
+			return nil, fmt.Errorf("tenant %q: set systemInstruction or systemInstructionFile, not both", name)
+		}
+		if t.SystemInstructionFile != "" {
+			text, err := os.ReadFile(t.SystemInstructionFile)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %q: %w", name, err)
+			}
+			t.SystemInstruction = string(text)
+		}
+		switch t.Docs.Store {
+		case "", "memory", "mongodb":
+		default:
+			return nil, fmt.Errorf("tenant %q: unknown docs store %q", name, t.Docs.Store)
+		}
+		if t.Quota.DailyTokens < 0 || t.Quota.DailyCost < 0 {
+			return nil, fmt.Errorf("tenant %q: quota must not be negative", name)
+		}
+		if t.SessionNamespace == "" {
+			t.SessionNamespace = name
+		}
+		if !validName.MatchString(t.SessionNamespace) {
+			return nil, fmt.Errorf("tenant %q: invalid sessionNamespace %q", name, t.SessionNamespace)
+		}
+		if other, ok := namespaces[t.SessionNamespace]; ok {
+			return nil, fmt.Errorf("tenant %q: sessionNamespace %q is already used by tenant %q", name, t.SessionNamespace, other)
+		}
+		namespaces[t.SessionNamespace] = name
+		cfg.Tenants[name] = t
+	}
+
+	return &cfg, nil
+}
+
+// Names returns the configured tenant names, sorted.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Tenants))
+	for name := range c.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the name of the tenant a request is for. Authenticated
+// callers get the tenant their credentials are bound to, or the default
+// tenant when they are bound to none; the tenant header may only repeat it,
+// and naming another tenant fails with ErrTenantForbidden. The header
+// selects the tenant only for unauthenticated requests, which reach Resolve
+// when authentication is disabled.
+func (c *Config) Resolve(r *http.Request) (string, error) {
+	requested := r.Header.Get(c.Header)
+
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		bound := cmp.Or(p.Tenant, c.Default)
+		if requested != "" && requested != bound {
+			return "", fmt.Errorf("%w: %q", ErrTenantForbidden, requested)
+		}
+		requested = bound
+	}
+
+	if requested == "" {
+		requested = c.Default
+	}
+	if requested == "" {
+		return "", fmt.Errorf("%w: no tenant selected; set the %s header", ErrUnknownTenant, c.Header)
+	}
+	if _, ok := c.Tenants[requested]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownTenant, requested)
+	}
+	return requested, nil
+}
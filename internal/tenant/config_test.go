@@ -0,0 +1,82 @@
+package tenant
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m2tx/agent_example/internal/auth"
+)
+
+func TestResolve(t *testing.T) {
+	cfg := &Config{
+		Default: "support",
+		Header:  DefaultHeader,
+		Tenants: map[string]Tenant{"support": {}, "hr": {}},
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		header    string
+		want      string
+		err       error
+	}{
+		{name: "auth disabled, no header", want: "support"},
+		{name: "auth disabled, header", header: "hr", want: "hr"},
+		{name: "auth disabled, unknown tenant", header: "sales", err: ErrUnknownTenant},
+
+		{name: "bound", principal: &auth.Principal{Subject: "a", Tenant: "hr"}, want: "hr"},
+		{name: "bound, same header", principal: &auth.Principal{Subject: "a", Tenant: "hr"}, header: "hr", want: "hr"},
+		{name: "bound, other header", principal: &auth.Principal{Subject: "a", Tenant: "hr"}, header: "support", err: ErrTenantForbidden},
+
+		{name: "unbound", principal: &auth.Principal{Subject: "b"}, want: "support"},
+		{name: "unbound, default header", principal: &auth.Principal{Subject: "b"}, header: "support", want: "support"},
+		{name: "unbound, other header", principal: &auth.Principal{Subject: "b"}, header: "hr", err: ErrTenantForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(DefaultHeader, tt.header)
+			}
+			if tt.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), tt.principal))
+			}
+
+			got, err := cfg.Resolve(r)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Resolve error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// Without a default tenant, unbound callers have no tenant at all.
+	noDefault := &Config{Header: DefaultHeader, Tenants: cfg.Tenants}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(DefaultHeader, "hr")
+	r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Subject: "b"}))
+	if _, err := noDefault.Resolve(r); !errors.Is(err, ErrTenantForbidden) {
+		t.Fatalf("Resolve without a default = %v, want ErrTenantForbidden", err)
+	}
+}
+
+func TestSamplingAllows(t *testing.T) {
+	if (Sampling{}).Allows("wiki") {
+		t.Error("sampling allowed without any server listed")
+	}
+	s := Sampling{Servers: []string{"wiki"}}
+	if !s.Allows("wiki") || s.Allows("default") {
+		t.Errorf("%+v: Allows(wiki) = %v, Allows(default) = %v", s, s.Allows("wiki"), s.Allows("default"))
+	}
+	if !(Sampling{Servers: []string{"*"}}).Allows("default") {
+		t.Error(`"*" does not allow every server`)
+	}
+}
@@ -0,0 +1,352 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+const (
+	hnswM              = 16
+	hnswMaxLevel0      = hnswM * 2
+	hnswEfConstruction = 100
+	hnswEfSearch       = 64
+
+	// exactSearchThreshold is the corpus size below which a linear scan is
+	// cheaper than walking the graph and returns exact results.
+	exactSearchThreshold = 1000
+)
+
+// vectorIndex is an in-process approximate nearest neighbour index based on
+// HNSW (Hierarchical Navigable Small World graphs). It supports concurrent
+// searches and incremental inserts. Vectors are expected to be L2-normalised,
+// so similarity is the plain dot product. Deleted vectors stay in the graph as
+// tombstones so it remains navigable, but are never returned by Search.
+type vectorIndex struct {
+	mu         sync.RWMutex
+	nodes      []hnswNode
+	deleted    map[int32]struct{}
+	entryPoint int
+	maxLevel   int
+	levelMult  float64
+	rng        *rand.Rand
+}
+
+type hnswNode struct {
+	vec       []float32
+	neighbors [][]int32
+}
+
+func newVectorIndex() *vectorIndex {
+	return &vectorIndex{
+		entryPoint: -1,
+		deleted:    make(map[int32]struct{}),
+		levelMult:  1 / math.Log(hnswM),
+		rng:        rand.New(rand.NewSource(42)),
+	}
+}
+
+// Len returns the number of live (not deleted) vectors in the index.
+func (ix *vectorIndex) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.nodes) - len(ix.deleted)
+}
+
+// Delete marks id as deleted so it is excluded from search results.
+func (ix *vectorIndex) Delete(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if id >= 0 && id < len(ix.nodes) {
+		ix.deleted[int32(id)] = struct{}{}
+	}
+}
+
+// Insert adds vec to the index and returns its id. Ids are assigned
+// sequentially starting at zero.
+func (ix *vectorIndex) Insert(vec []float32) int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	id := len(ix.nodes)
+	level := int(-math.Log(1-ix.rng.Float64()) * ix.levelMult)
+	ix.nodes = append(ix.nodes, hnswNode{vec: vec, neighbors: make([][]int32, level+1)})
+
+	if ix.entryPoint < 0 {
+		ix.entryPoint = id
+		ix.maxLevel = level
+		return id
+	}
+
+	ep := ix.entryPoint
+	for l := ix.maxLevel; l > level; l-- {
+		ep = ix.greedyClosest(vec, ep, l)
+	}
+
+	for l := min(level, ix.maxLevel); l >= 0; l-- {
+		candidates := ix.searchLayer(vec, ep, hnswEfConstruction, l, false)
+		maxConn := hnswM
+		if l == 0 {
+			maxConn = hnswMaxLevel0
+		}
+		neighbors := ix.selectNeighbors(candidates, hnswM)
+		ix.nodes[id].neighbors[l] = neighbors
+		for _, n := range neighbors {
+			ix.connect(int(n), int32(id), l, maxConn)
+		}
+		ep = int(candidates[0].id)
+	}
+
+	if level > ix.maxLevel {
+		ix.maxLevel = level
+		ix.entryPoint = id
+	}
+	return id
+}
+
+// Search returns the ids of the k vectors most similar to query, best first.
+func (ix *vectorIndex) Search(query []float32, k int) []scoredID {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	if len(ix.nodes) == len(ix.deleted) || k <= 0 {
+		return nil
+	}
+
+	if len(ix.nodes) <= exactSearchThreshold {
+		return ix.exactSearch(query, k)
+	}
+
+	ep := ix.entryPoint
+	for l := ix.maxLevel; l > 0; l-- {
+		ep = ix.greedyClosest(query, ep, l)
+	}
+
+	results := ix.searchLayer(query, ep, max(hnswEfSearch, k), 0, true)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// exactSearch scans every vector, keeping the best k in a bounded min-heap.
+func (ix *vectorIndex) exactSearch(query []float32, k int) []scoredID {
+	top := make(minScoreHeap, 0, k)
+	for i := range ix.nodes {
+		if ix.isDeleted(int32(i)) {
+			continue
+		}
+		top.pushBounded(scoredID{id: int32(i), score: dot(query, ix.nodes[i].vec)}, k)
+	}
+	return drainDescending(&top)
+}
+
+// greedyClosest walks layer l from ep towards the node most similar to vec.
+func (ix *vectorIndex) greedyClosest(vec []float32, ep int, l int) int {
+	best := dot(vec, ix.nodes[ep].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range ix.nodes[ep].neighbors[l] {
+			if s := dot(vec, ix.nodes[n].vec); s > best {
+				best, ep, changed = s, int(n), true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer performs a best-first search on layer l and returns up to ef
+// nodes sorted by descending similarity. When skipDeleted is set, tombstoned
+// nodes are traversed but left out of the results.
+func (ix *vectorIndex) searchLayer(vec []float32, ep int, ef int, l int, skipDeleted bool) []scoredID {
+	visited := ix.acquireVisited()
+	defer visitedPool.Put(visited)
+	visited.visit(int32(ep))
+	start := scoredID{id: int32(ep), score: dot(vec, ix.nodes[ep].vec)}
+
+	candidates := maxScoreHeap{start}
+	results := minScoreHeap{}
+	if !skipDeleted || !ix.isDeleted(start.id) {
+		results = append(results, start)
+	}
+
+	for len(candidates) > 0 {
+		c := heap.Pop(&candidates).(scoredID)
+		if len(results) >= ef && c.score < results[0].score {
+			break
+		}
+		for _, n := range ix.nodes[c.id].neighbors[l] {
+			if !visited.visit(n) {
+				continue
+			}
+			s := dot(vec, ix.nodes[n].vec)
+			if len(results) < ef || s > results[0].score {
+				heap.Push(&candidates, scoredID{id: n, score: s})
+				if skipDeleted && ix.isDeleted(n) {
+					continue
+				}
+				heap.Push(&results, scoredID{id: n, score: s})
+				if len(results) > ef {
+					heap.Pop(&results)
+				}
+			}
+		}
+	}
+
+	return drainDescending(&results)
+}
+
+// connect adds a back-link from node to neighbor on layer l, pruning the
+// node's neighbour list back to maxConn entries when it overflows.
+func (ix *vectorIndex) connect(node int, neighbor int32, l int, maxConn int) {
+	links := append(ix.nodes[node].neighbors[l], neighbor)
+	if len(links) > maxConn {
+		scored := make([]scoredID, len(links))
+		for i, n := range links {
+			scored[i] = scoredID{id: n, score: dot(ix.nodes[node].vec, ix.nodes[n].vec)}
+		}
+		top := minScoreHeap(scored)
+		heap.Init(&top)
+		links = ix.selectNeighbors(drainDescending(&top), maxConn)
+	}
+	ix.nodes[node].neighbors[l] = links
+}
+
+// selectNeighbors picks up to m links from candidates (sorted best first)
+// using the HNSW diversity heuristic: a candidate is kept only if it is more
+// similar to the base node than to any already selected neighbour. Remaining
+// slots are filled with the closest discarded candidates.
+func (ix *vectorIndex) selectNeighbors(sorted []scoredID, m int) []int32 {
+	ids := make([]int32, 0, m)
+	var skipped []int32
+	for _, c := range sorted {
+		if len(ids) >= m {
+			break
+		}
+		diverse := true
+		for _, sel := range ids {
+			if dot(ix.nodes[c.id].vec, ix.nodes[sel].vec) > c.score {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			ids = append(ids, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+	for _, id := range skipped {
+		if len(ids) >= m {
+			break
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (ix *vectorIndex) isDeleted(id int32) bool {
+	_, gone := ix.deleted[id]
+	return gone
+}
+
+func dot(a, b []float32) float32 {
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+// ---- visited set ----
+
+// visitedSet marks nodes seen during a single graph search. It is pooled and
+// reset by bumping a generation counter instead of clearing memory.
+type visitedSet struct {
+	marks []uint32
+	gen   uint32
+}
+
+var visitedPool = sync.Pool{New: func() any { return &visitedSet{} }}
+
+func (ix *vectorIndex) acquireVisited() *visitedSet {
+	v := visitedPool.Get().(*visitedSet)
+	if len(v.marks) < len(ix.nodes) {
+		v.marks = make([]uint32, len(ix.nodes)+len(ix.nodes)/2)
+		v.gen = 0
+	}
+	v.gen++
+	if v.gen == 0 {
+		clear(v.marks)
+		v.gen = 1
+	}
+	return v
+}
+
+// visit marks id and reports whether it had not been seen before.
+func (v *visitedSet) visit(id int32) bool {
+	if v.marks[id] == v.gen {
+		return false
+	}
+	v.marks[id] = v.gen
+	return true
+}
+
+// ---- heap helpers ----
+
+type scoredID struct {
+	id    int32
+	score float32
+}
+
+// minScoreHeap keeps the lowest score at the root; used for bounded top-K.
+type minScoreHeap []scoredID
+
+func (h minScoreHeap) Len() int           { return len(h) }
+func (h minScoreHeap) Less(i, j int) bool { return h[i].score < h[j].score }
+func (h minScoreHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minScoreHeap) Push(x any)        { *h = append(*h, x.(scoredID)) }
+func (h *minScoreHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// pushBounded adds s while keeping at most k entries, evicting the lowest
+// score when full.
+func (h *minScoreHeap) pushBounded(s scoredID, k int) {
+	if len(*h) < k {
+		heap.Push(h, s)
+		return
+	}
+	if s.score <= (*h)[0].score {
+		return
+	}
+	(*h)[0] = s
+	heap.Fix(h, 0)
+}
+
+// maxScoreHeap keeps the highest score at the root; used for the candidate queue.
+type maxScoreHeap []scoredID
+
+func (h maxScoreHeap) Len() int           { return len(h) }
+func (h maxScoreHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h maxScoreHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxScoreHeap) Push(x any)        { *h = append(*h, x.(scoredID)) }
+func (h *maxScoreHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// drainDescending empties h and returns its contents best first.
+func drainDescending(h *minScoreHeap) []scoredID {
+	out := make([]scoredID, h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(h).(scoredID)
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+package vectorstore
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// testDim is the dimension of the test vectors. It is smaller than a real
+// embedding so the 1M-chunk benchmark fits in memory; search cost grows
+// linearly with it.
+const testDim = 128
+
+// testVectors returns n corpus vectors and m query vectors, normalised and
+// grouped around the same clusters, which is closer to how text embeddings
+// are distributed than uniform noise.
+func testVectors(seed int64, n, m int) (corpus, queries [][]float32) {
+	rng := rand.New(rand.NewSource(seed))
+	centers := make([][]float32, 64)
+	for i := range centers {
+		centers[i] = randomVector(rng, nil, 1)
+	}
+	vecs := make([][]float32, n+m)
+	for i := range vecs {
+		vecs[i] = randomVector(rng, centers[rng.Intn(len(centers))], 1.5)
+	}
+	return vecs[:n], vecs[n:]
+}
+
+// randomVector returns a normalised vector offset from center by noise.
+func randomVector(rng *rand.Rand, center []float32, noise float64) []float32 {
+	v := make([]float32, testDim)
+	var norm float64
+	for i := range v {
+		x := rng.NormFloat64() * noise
+		if center != nil {
+			x += float64(center[i]) * math.Sqrt(testDim)
+		}
+		v[i] = float32(x)
+		norm += x * x
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range v {
+		v[i] *= scale
+	}
+	return v
+}
+
+func buildIndex(vecs [][]float32) *vectorIndex {
+	ix := newVectorIndex()
+	for _, v := range vecs {
+		ix.Insert(v)
+	}
+	return ix
+}
+
+// recall returns the fraction of the exact top k that Search returned.
+func recall(ix *vectorIndex, queries [][]float32, k int) float64 {
+	var found, total int
+	for _, q := range queries {
+		got := make(map[int32]bool)
+		for _, h := range ix.Search(q, k) {
+			got[h.id] = true
+		}
+		ix.mu.RLock()
+		want := ix.exactSearch(q, k)
+		ix.mu.RUnlock()
+		for _, h := range want {
+			if got[h.id] {
+				found++
+			}
+		}
+		total += len(want)
+	}
+	return float64(found) / float64(total)
+}
+
+func TestVectorIndexRecall(t *testing.T) {
+	corpus, queries := testVectors(1, 10_000, 200)
+	ix := buildIndex(corpus)
+
+	for _, k := range []int{1, 10, 50} {
+		r := recall(ix, queries, k)
+		t.Logf("recall@%d = %.3f", k, r)
+		if r < 0.95 {
+			t.Errorf("recall@%d = %.3f, want at least 0.95", k, r)
+		}
+	}
+}
+
+func TestVectorIndexRecallAfterDelete(t *testing.T) {
+	vecs, queries := testVectors(2, 5_000, 200)
+	ix := buildIndex(vecs)
+	for id := 0; id < len(vecs); id += 3 {
+		ix.Delete(id)
+	}
+	if got, want := ix.Len(), len(vecs)-(len(vecs)+2)/3; got != want {
+		t.Fatalf("Len = %d, want %d", got, want)
+	}
+
+	for _, q := range queries {
+		for _, h := range ix.Search(q, 10) {
+			if h.id%3 == 0 {
+				t.Fatalf("Search returned deleted vector %d", h.id)
+			}
+		}
+	}
+	if r := recall(ix, queries, 10); r < 0.95 {
+		t.Errorf("recall@10 after deletes = %.3f, want at least 0.95", r)
+	}
+}
+
+func TestVectorIndexSearch(t *testing.T) {
+	ix := newVectorIndex()
+	if got := ix.Search(randomVector(rand.New(rand.NewSource(3)), nil, 1), 5); got != nil {
+		t.Fatalf("Search on an empty index = %v, want nil", got)
+	}
+
+	// Below exactSearchThreshold the results are exact and best first.
+	vecs, _ := testVectors(3, 500, 0)
+	for _, v := range vecs {
+		ix.Insert(v)
+	}
+	for _, id := range []int{0, 42, 499} {
+		got := ix.Search(vecs[id], 5)
+		if len(got) != 5 || got[0].id != int32(id) {
+			t.Fatalf("Search(vecs[%d]) = %v, want it first of 5", id, got)
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i].score > got[i-1].score {
+				t.Fatalf("Search(vecs[%d]) is not sorted: %v", id, got)
+			}
+		}
+	}
+}
+
+var benchSizes = []int{10_000, 100_000, 1_000_000}
+
+var benchIndexes = struct {
+	sync.Mutex
+	m map[int]benchData
+}{m: make(map[int]benchData)}
+
+type benchData struct {
+	ix      *vectorIndex
+	queries [][]float32
+}
+
+// benchIndex returns an index of n vectors and vectors from the same
+// distribution to search or insert, built once per process since the larger
+// indexes take minutes.
+func benchIndex(b *testing.B, n int) (*vectorIndex, [][]float32) {
+	if n >= 1_000_000 && testing.Short() {
+		b.Skip("skipping the 1M-chunk index in short mode")
+	}
+	benchIndexes.Lock()
+	defer benchIndexes.Unlock()
+	if d, ok := benchIndexes.m[n]; ok {
+		return d.ix, d.queries
+	}
+	corpus, queries := testVectors(int64(n), n, 10_000)
+	ix := buildIndex(corpus)
+	benchIndexes.m[n] = benchData{ix, queries}
+	return ix, queries
+}
+
+// clone copies ix so benchmarks can insert into it without growing the
+// shared index.
+func (ix *vectorIndex) clone() *vectorIndex {
+	c := &vectorIndex{
+		nodes:      make([]hnswNode, len(ix.nodes)),
+		deleted:    make(map[int32]struct{}),
+		entryPoint: ix.entryPoint,
+		maxLevel:   ix.maxLevel,
+		levelMult:  ix.levelMult,
+		rng:        rand.New(rand.NewSource(42)),
+	}
+	for i, n := range ix.nodes {
+		c.nodes[i].vec = n.vec
+		c.nodes[i].neighbors = make([][]int32, len(n.neighbors))
+		for l, links := range n.neighbors {
+			c.nodes[i].neighbors[l] = append([]int32(nil), links...)
+		}
+	}
+	return c
+}
+
+func BenchmarkSearch(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("chunks=%d", n), func(b *testing.B) {
+			ix, queries := benchIndex(b, n)
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				ix.Search(queries[i%len(queries)], 10)
+			}
+		})
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("chunks=%d", n), func(b *testing.B) {
+			ix, vecs := benchIndex(b, n)
+			ix = ix.clone()
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				ix.Insert(vecs[i%len(vecs)])
+			}
+		})
+	}
+}
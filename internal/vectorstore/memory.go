@@ -0,0 +1,131 @@
+package vectorstore
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MemoryVectorStore implements VectorStore in process, backed by an HNSW index.
+// It is safe for concurrent use: searches may run while new documents are added.
+type MemoryVectorStore struct {
+	addMu      sync.Mutex // serialises Add so index ids match positions in docs
+	mu         sync.RWMutex
+	docs       []Document
+	byDocument map[string][]int
+	order      []string
+	index      *vectorIndex
+}
+
+// NewMemoryVectorStore creates an empty MemoryVectorStore.
+func NewMemoryVectorStore() *MemoryVectorStore {
+	return &MemoryVectorStore{
+		byDocument: make(map[string][]int),
+		index:      newVectorIndex(),
+	}
+}
+
+func (s *MemoryVectorStore) Add(ctx context.Context, docs ...Document) error {
+	s.addMu.Lock()
+	defer s.addMu.Unlock()
+
+	for _, doc := range docs {
+		s.mu.Lock()
+		id := len(s.docs)
+		s.docs = append(s.docs, doc)
+		if _, seen := s.byDocument[doc.DocumentID]; !seen {
+			s.order = append(s.order, doc.DocumentID)
+		}
+		s.byDocument[doc.DocumentID] = append(s.byDocument[doc.DocumentID], id)
+		s.mu.Unlock()
+
+		s.index.Insert(doc.Embedding)
+	}
+
+	return nil
+}
+
+func (s *MemoryVectorStore) Search(ctx context.Context, vector []float32, topK int) ([]Document, error) {
+	hits := s.index.Search(vector, topK)
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Document, 0, len(hits))
+	for _, h := range hits {
+		doc := s.docs[h.id]
+		if _, live := s.byDocument[doc.DocumentID]; !live {
+			continue // deleted after the index was searched
+		}
+		out = append(out, doc)
+	}
+	return out, nil
+}
+
+func (s *MemoryVectorStore) Count(ctx context.Context) (int, error) {
+	return s.index.Len(), nil
+}
+
+func (s *MemoryVectorStore) List(ctx context.Context) ([]DocumentInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]DocumentInfo, 0, len(s.order))
+	for _, documentID := range s.order {
+		ids := s.byDocument[documentID]
+		first := s.docs[ids[0]]
+		infos = append(infos, DocumentInfo{
+			ID:       documentID,
+			Filename: first.Filename,
+			Chunks:   len(ids),
+			Metadata: first.Metadata,
+		})
+	}
+	return infos, nil
+}
+
+func (s *MemoryVectorStore) Get(ctx context.Context, documentID string) ([]Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids, ok := s.byDocument[documentID]
+	if !ok {
+		return nil, nil
+	}
+
+	out := make([]Document, len(ids))
+	for i, id := range ids {
+		out[i] = s.docs[id]
+	}
+	return out, nil
+}
+
+func (s *MemoryVectorStore) Delete(ctx context.Context, documentID string) error {
+	s.addMu.Lock()
+	defer s.addMu.Unlock()
+
+	s.mu.Lock()
+	ids := s.byDocument[documentID]
+	delete(s.byDocument, documentID)
+	s.order = slices.DeleteFunc(s.order, func(id string) bool { return id == documentID })
+	s.mu.Unlock()
+
+	// The index keeps the vectors as tombstones; only the chunk text is released.
+	for _, id := range ids {
+		s.index.Delete(id)
+	}
+
+	s.mu.Lock()
+	for _, id := range ids {
+		s.docs[id] = Document{DocumentID: documentID}
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Ensure the interface is satisfied at compile time.
+var _ VectorStore = (*MemoryVectorStore)(nil)
@@ -0,0 +1,261 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// nativeRetryInterval is how long Search uses the brute-force scan after
+// finding native vector search unavailable, before trying it again.
+const nativeRetryInterval = 10 * time.Minute
+
+// Server error codes meaning the deployment cannot run $vectorSearch.
+const (
+	codeUnrecognizedPipelineStage = 40324 // not Atlas or Atlas Local
+	codeSearchNotEnabled          = 31082 // Atlas Search is not configured
+)
+
+// MongoVectorStore implements VectorStore using a MongoDB collection.
+// Search uses the $vectorSearch aggregation stage when a native vector index
+// is available (MongoDB Atlas or Atlas Local) and falls back to a brute-force
+// scan when the deployment does not support it or the index does not exist.
+type MongoVectorStore struct {
+	collection *mongo.Collection
+	indexName  string
+
+	// nativeRetryAt is the Unix time in nanoseconds before which native
+	// vector search is known to be unavailable.
+	nativeRetryAt atomic.Int64
+
+	// indexed reports whether the document_id index is known to exist.
+	indexed atomic.Bool
+}
+
+// NewMongoVectorStore creates a new MongoVectorStore.
+// collectionName defaults to "chunks" and indexName to "vector_index" if empty.
+func NewMongoVectorStore(db *mongo.Database, collectionName string, indexName string) *MongoVectorStore {
+	if collectionName == "" {
+		collectionName = "chunks"
+	}
+	if indexName == "" {
+		indexName = "vector_index"
+	}
+	return &MongoVectorStore{
+		collection: db.Collection(collectionName),
+		indexName:  indexName,
+	}
+}
+
+func (s *MongoVectorStore) Add(ctx context.Context, docs ...Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	if err := s.ensureIndex(ctx); err != nil {
+		return err
+	}
+
+	batch := make([]any, len(docs))
+	for i, doc := range docs {
+		batch[i] = doc
+	}
+
+	if _, err := s.collection.InsertMany(ctx, batch); err != nil {
+		return fmt.Errorf("vectorstore: insert chunks: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MongoVectorStore) Search(ctx context.Context, vector []float32, topK int) ([]Document, error) {
+	if topK <= 0 {
+		return nil, nil
+	}
+
+	if time.Now().UnixNano() >= s.nativeRetryAt.Load() {
+		docs, err := s.nativeSearch(ctx, vector, topK)
+		if err != nil && !nativeUnsupported(err) {
+			return nil, err
+		}
+		if err == nil && len(docs) == 0 {
+			// $vectorSearch returns nothing, rather than failing, when the
+			// index does not exist or is still building.
+			n, cerr := s.collection.EstimatedDocumentCount(ctx)
+			if cerr != nil {
+				return nil, fmt.Errorf("vectorstore: count chunks: %w", cerr)
+			}
+			if n > 0 {
+				err = fmt.Errorf("vector search index %q returned no results for %d chunks", s.indexName, n)
+			}
+		}
+		if err == nil {
+			return docs, nil
+		}
+		log.Printf("vectorstore: native vector search unavailable, using a brute-force scan for %v: %v", nativeRetryInterval, err)
+		s.nativeRetryAt.Store(time.Now().Add(nativeRetryInterval).UnixNano())
+	}
+
+	return s.scanSearch(ctx, vector, topK)
+}
+
+// nativeUnsupported reports whether err means $vectorSearch cannot run on
+// the deployment, as opposed to a transient failure.
+func nativeUnsupported(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) &&
+		(se.HasErrorCode(codeUnrecognizedPipelineStage) || se.HasErrorCode(codeSearchNotEnabled))
+}
+
+func (s *MongoVectorStore) Count(ctx context.Context) (int, error) {
+	n, err := s.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, fmt.Errorf("vectorstore: count chunks: %w", err)
+	}
+	return int(n), nil
+}
+
+func (s *MongoVectorStore) List(ctx context.Context) ([]DocumentInfo, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$document_id",
+			"filename": bson.M{"$first": "$filename"},
+			"metadata": bson.M{"$first": "$metadata"},
+			"chunks":   bson.M{"$sum": 1},
+			"first":    bson.M{"$min": "$_id"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"first": 1}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore: list documents: %w", err)
+	}
+
+	infos := []DocumentInfo{}
+	if err := cursor.All(ctx, &infos); err != nil {
+		return nil, fmt.Errorf("vectorstore: decode documents: %w", err)
+	}
+	return infos, nil
+}
+
+func (s *MongoVectorStore) Get(ctx context.Context, documentID string) ([]Document, error) {
+	filter := bson.M{"document_id": documentID}
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore: find document %q: %w", documentID, err)
+	}
+
+	var docs []Document
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("vectorstore: decode document %q: %w", documentID, err)
+	}
+	return docs, nil
+}
+
+func (s *MongoVectorStore) Delete(ctx context.Context, documentID string) error {
+	filter := bson.M{"document_id": documentID}
+
+	if _, err := s.collection.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("vectorstore: delete document %q: %w", documentID, err)
+	}
+
+	return nil
+}
+
+// ensureIndex creates the index on document_id used by Get and Delete, once
+// per store. Creating an index that already exists is a no-op.
+func (s *MongoVectorStore) ensureIndex(ctx context.Context) error {
+	if s.indexed.Load() {
+		return nil
+	}
+	model := mongo.IndexModel{Keys: bson.D{{Key: "document_id", Value: 1}}}
+	if _, err := s.collection.Indexes().CreateOne(ctx, model); err != nil {
+		return fmt.Errorf("vectorstore: create document_id index: %w", err)
+	}
+	s.indexed.Store(true)
+	return nil
+}
+
+// nativeSearch queries the Atlas vector search index.
+func (s *MongoVectorStore) nativeSearch(ctx context.Context, vector []float32, topK int) ([]Document, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: bson.M{
+			"index":         s.indexName,
+			"path":          "embedding",
+			"queryVector":   vector,
+			"numCandidates": topK * 20,
+			"limit":         topK,
+		}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore: vector search: %w", err)
+	}
+
+	var docs []Document
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("vectorstore: decode vector search: %w", err)
+	}
+	return docs, nil
+}
+
+// scanSearch streams every chunk and keeps the best topK in a bounded heap.
+func (s *MongoVectorStore) scanSearch(ctx context.Context, vector []float32, topK int) ([]Document, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore: scan chunks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	top := make(minScoreHeap, 0, topK)
+	kept := make([]Document, 0, topK)
+
+	for cursor.Next(ctx) {
+		var doc Document
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("vectorstore: decode chunk: %w", err)
+		}
+		if len(doc.Embedding) != len(vector) {
+			continue
+		}
+
+		score := dot(vector, doc.Embedding)
+		switch {
+		case len(kept) < topK:
+			kept = append(kept, doc)
+			top.pushBounded(scoredID{id: int32(len(kept) - 1), score: score}, topK)
+		case score > top[0].score:
+			slot := top[0].id
+			kept[slot] = doc
+			top.pushBounded(scoredID{id: slot, score: score}, topK)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("vectorstore: scan chunks: %w", err)
+	}
+
+	if len(kept) == 0 {
+		return nil, nil
+	}
+
+	hits := drainDescending(&top)
+	out := make([]Document, len(hits))
+	for i, h := range hits {
+		out[i] = kept[h.id]
+	}
+	return out, nil
+}
+
+// Ensure the interface is satisfied at compile time.
+var _ VectorStore = (*MongoVectorStore)(nil)
@@ -0,0 +1,48 @@
+package vectorstore
+
+import (
+	"context"
+)
+
+// Document is a text chunk paired with its embedding vector.
+type Document struct {
+	DocumentID string         `bson:"document_id" json:"document_id"`
+	Filename   string         `bson:"filename" json:"filename"`
+	Chunk      int            `bson:"chunk" json:"chunk"`
+	Text       string         `bson:"text" json:"text"`
+	Embedding  []float32      `bson:"embedding" json:"-"`
+	Metadata   map[string]any `bson:"metadata,omitempty" json:"metadata,omitempty"`
+}
+
+// DocumentInfo summarises a source document whose chunks are stored.
+type DocumentInfo struct {
+	ID       string         `bson:"_id" json:"id"`
+	Filename string         `bson:"filename" json:"filename"`
+	Chunks   int            `bson:"chunks" json:"chunks"`
+	Metadata map[string]any `bson:"metadata,omitempty" json:"metadata,omitempty"`
+}
+
+// VectorStore persists embedded chunks and answers similarity queries.
+// Embeddings are expected to be L2-normalised.
+type VectorStore interface {
+	// Add stores the given chunks.
+	Add(ctx context.Context, docs ...Document) error
+
+	// Search returns the topK chunks most similar to vector, best first.
+	// Returns nil, nil if the store is empty.
+	Search(ctx context.Context, vector []float32, topK int) ([]Document, error)
+
+	// Count returns the number of stored chunks.
+	Count(ctx context.Context) (int, error)
+
+	// List returns one entry per source document, grouped by DocumentID.
+	List(ctx context.Context) ([]DocumentInfo, error)
+
+	// Get returns the chunks belonging to documentID in insertion order.
+	// Returns nil, nil if the document does not exist.
+	Get(ctx context.Context, documentID string) ([]Document, error)
+
+	// Delete removes every chunk belonging to documentID.
+	// Is a no-op if the document does not exist.
+	Delete(ctx context.Context, documentID string) error
+}